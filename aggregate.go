@@ -0,0 +1,186 @@
+package tact
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brunotm/tact/js"
+)
+
+// Aggregation functions. Percentiles are specified as pN, eg. p95
+const (
+	AggSum   = "sum"
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggCount = "count"
+)
+
+// Aggregate summarizes the events of a run grouped by a set of fields.
+// Summary events have the aggregated fields named as field_function, eg. io_rate_avg_sum
+type Aggregate struct {
+	Name    string              // Summary name, appended to the collector name for the summary events _metric
+	GroupBy []string            // Fields to group events by, when empty all events are aggregated together
+	Fields  map[string][]string // Fields:Functions to aggregate
+	Where   *Filter             // When set, only the events matching its predicates are aggregated
+	Drop    bool                // Emit only the summary events, dropping the raw ones
+	fields  []string
+}
+
+// init validates the aggregate definitions
+func (a *Aggregate) init() (err error) {
+	if a.Name == "" {
+		return fmt.Errorf("aggregate with empty name")
+	}
+
+	if len(a.Fields) == 0 {
+		return fmt.Errorf("aggregate %s: no fields to aggregate", a.Name)
+	}
+
+	a.fields = make([]string, 0, len(a.Fields))
+	for field, fns := range a.Fields {
+		for _, fn := range fns {
+			if _, err = aggregateFn(fn); err != nil {
+				return fmt.Errorf("aggregate %s: field %s: %s", a.Name, field, err)
+			}
+		}
+		a.fields = append(a.fields, field)
+	}
+	sort.Strings(a.fields)
+
+	if a.Where != nil {
+		if err = a.Where.Compile(); err != nil {
+			return fmt.Errorf("aggregate %s: %s", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// aggregateFn returns the function to calculate the given aggregation
+func aggregateFn(name string) (fn func(values []float64) float64, err error) {
+	switch name {
+	case AggSum:
+		return sum, nil
+	case AggAvg:
+		return func(values []float64) float64 { return sum(values) / float64(len(values)) }, nil
+	case AggMin:
+		return func(values []float64) float64 { return sorted(values)[0] }, nil
+	case AggMax:
+		return func(values []float64) float64 { return sorted(values)[len(values)-1] }, nil
+	case AggCount:
+		return func(values []float64) float64 { return float64(len(values)) }, nil
+	}
+
+	if strings.HasPrefix(name, "p") {
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile: %s", name)
+		}
+		return func(values []float64) float64 { return percentile(values, p) }, nil
+	}
+	return nil, fmt.Errorf("unknown aggregation function: %s", name)
+}
+
+// aggregator holds the aggregation state for a run
+type aggregator struct {
+	*Aggregate
+	groups map[string]*aggregateGroup
+	order  []string
+}
+
+// aggregateGroup holds the values for a group
+type aggregateGroup struct {
+	labels []byte
+	values map[string][]float64
+}
+
+func newAggregator(a *Aggregate) (agg *aggregator) {
+	return &aggregator{Aggregate: a, groups: map[string]*aggregateGroup{}}
+}
+
+// observe adds the given event values to its group
+func (a *aggregator) observe(event []byte) {
+	if a.Where != nil && !a.Where.Match(event) {
+		return
+	}
+
+	values := make([]string, len(a.GroupBy))
+	for i := range a.GroupBy {
+		values[i], _ = js.GetUnsafeString(event, a.GroupBy[i])
+	}
+	groupKey := strings.Join(values, "\x00")
+
+	group, ok := a.groups[groupKey]
+	if !ok {
+		group = &aggregateGroup{values: map[string][]float64{}}
+		for _, field := range a.GroupBy {
+			if value, err := js.GetValue(event, field); err == nil {
+				group.labels, _ = js.Set(group.labels, value, field)
+			}
+		}
+		a.groups[groupKey] = group
+		a.order = append(a.order, groupKey)
+	}
+
+	for _, field := range a.fields {
+		if value, err := js.GetFloat(event, field); err == nil {
+			group.values[field] = append(group.values[field], value)
+		}
+	}
+}
+
+// summaries returns the summary events for each group
+func (a *aggregator) summaries() (events [][]byte, err error) {
+	for _, groupKey := range a.order {
+		group := a.groups[groupKey]
+		event := group.labels
+
+		for _, field := range a.fields {
+			values := group.values[field]
+			for _, name := range a.Fields[field] {
+				fn, _ := aggregateFn(name)
+
+				var result interface{}
+				if len(values) > 0 {
+					result = fn(values)
+				} else if name == AggCount {
+					result = 0
+				}
+
+				if event, err = js.Set(event, result, field+"_"+name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func sum(values []float64) (s float64) {
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+// sorted returns a sorted copy of the given values
+func sorted(values []float64) (s []float64) {
+	s = make([]float64, len(values))
+	copy(s, values)
+	sort.Float64s(s)
+	return s
+}
+
+// percentile using the nearest rank method
+func percentile(values []float64, p float64) (v float64) {
+	s := sorted(values)
+	rank := int(math.Ceil(p/100*float64(len(s)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return s[rank]
+}
@@ -1,84 +1,141 @@
 package tact
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/brunotm/tact/js"
+	"github.com/brunotm/tact/log"
 	"github.com/brunotm/tact/proto"
 	"github.com/brunotm/tact/storage"
 )
 
 var (
-	cachePrefix = []byte(`cache`)
+	cachePrefix     = []byte(`cache`)
+	cacheTimePrefix = []byte(`cachetime`)
+
+	// refreshes deduplicates concurrent cache refreshes for the same collector and node
+	refreshes = newRefreshGroup()
 )
 
-// GetCache returns a cached or new map[keyfield]value for the given collector
-func getCache(ctx *Context, ttl time.Duration, collname string, keyFields []string) (cache map[string][]byte, err error) {
+// getCache returns a cached or new map[keyfield]value for the joined collector on the given node,
+// applying the join refresh policy. The collector is run synchronously only when there is no usable data.
+// Data is shared across runs through the process wide join cache in front of the Store
+func getCache(ctx *Context, node *Node, join *Join) (cache map[string][]byte, err error) {
+	name := join.Name + "/" + node.HostName
 
-	// Get last data
-	data, err := ctx.txn.Get(append(cachePrefix, []byte(collname+"/"+ctx.node.HostName)...))
+	entry, err := joinCache.get(name, func() (*cacheEntry, error) {
+		return loadCache(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// Run collector if not cached
-	if err == storage.ErrKeyNotFound {
-		return cacheRun(ctx, collname, keyFields, ttl)
+	var age time.Duration
+	if entry != nil {
+		age = time.Since(entry.updated)
+	}
+
+	switch {
+	// Run collector if not cached or too stale
+	case entry == nil || age >= join.TTL+join.MaxStale:
+		if entry, err = refreshes.do(ctx, node, join); err != nil {
+			return nil, err
+		}
+
+	// Expired, serve the stale data while refreshing in background
+	case age >= join.TTL:
+		ctx.LogWarn("serving stale cache data", "collector", join.Name,
+			"cache_node", node.HostName, "age_seconds", age.Seconds())
+		refreshes.background(ctx, node, join)
+
+	// Fresh, refresh in background ahead of expiry
+	case join.RefreshAfter > 0 && age >= join.RefreshAfter:
+		refreshes.background(ctx, node, join)
 	}
 
+	return entry.index(ctx, join.onKeys), nil
+}
+
+// loadCache decodes the stored data for the given collector and node, nil if not stored.
+// It is read in its own read only transaction, as the refreshes write it outside of the
+// session transaction and reading it there would make the session commit conflict
+func loadCache(ctx *Context, name string) (entry *cacheEntry, err error) {
+	txn := ctx.store.NewTxn(false)
+	defer txn.Discard()
+
+	data, err := txn.Get(append(cachePrefix, name...))
+	if err == storage.ErrKeyNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	cacheData := &proto.Cache{}
-	err = cacheData.Unmarshal(data)
+	var updated time.Time
+	raw, err := txn.Get(append(cacheTimePrefix, name...))
+	if err == nil {
+		err = updated.UnmarshalJSON(raw)
+	}
 	if err != nil {
+		// Data stored without an update time, consider it as fresh as its TTL allows
+		updated = time.Now()
+	}
+
+	cacheData := &proto.Cache{}
+	if err = cacheData.Unmarshal(data); err != nil {
 		return nil, err
 	}
+	return newCacheEntry(cacheData.Data, updated), nil
+}
 
-	// Index with given keys
+// indexCache indexes the given events with the given keys
+func indexCache(ctx *Context, events [][]byte, keys []*Key) (cache map[string][]byte) {
 	cache = make(map[string][]byte)
-	for i := range cacheData.Data {
-		for kf := range keyFields {
-			if key, err := js.GetUnsafeString(cacheData.Data[i], keyFields[kf]); err == nil {
-				cache[key] = cacheData.Data[i]
+	for i := range events {
+		for k := range keys {
+			if key, err := keys[k].Value(events[i]); err == nil {
+				cache[key] = events[i]
 			} else {
-				ctx.LogError("could not index", "event", string(cacheData.Data[i]), "key", keyFields[kf], "error", err)
+				ctx.LogError("could not index", "event", string(events[i]), "key", keys[k].String(), "error", err)
 			}
 		}
 	}
-	return cache, err
+	return cache
 }
 
-func cacheRun(ctx *Context, collname string, keyFields []string, ttl time.Duration) (cache map[string][]byte, err error) {
-	collector := Registry.Get(collname)
-
-	if len(keyFields) == 0 {
-		return nil, fmt.Errorf("empty key fields for caching")
+// cacheRun runs the joined collector on the given node and stores its events in the Store and join cache.
+// The run is independent from the calling context so it can be shared by concurrent callers
+// and outlive them when refreshing in background, but it is bound by the caller timeout
+// and cancelled with the given root context. The joins of the joined collector resolve their nodes from the given ones
+func cacheRun(root context.Context, timeout time.Duration, nodes map[string]*Node, node *Node, join *Join) (entry *cacheEntry, err error) {
+	collector, ok := Registry.lookup(join.Name)
+	if !ok {
+		return nil, fmt.Errorf("collector %s does not exist", join.Name)
 	}
 
-	// Create the cache object
-	cache = make(map[string][]byte)
+	child, err := NewContext(root, collector.Name, node, Store, timeout)
+	if err != nil {
+		return nil, err
+	}
+	child.joinCache = true
+	child.nodes = nodes
 
 	wchan := make(chan []byte)
 	go func() {
-		child, err := ctx.child(collector.Name)
-		if err != nil {
-			ctx.LogError("creating child session", "error", err)
-			return
-		}
 		collector.Start(child, wchan)
 		close(wchan)
 	}()
 
 	cacheData := &proto.Cache{}
 	for event := range wchan {
-		for i := range keyFields {
-			key, err := js.GetUnsafeString(event, keyFields[i])
-			if err != nil {
-				continue
-			}
-			cache[key] = event
-			cacheData.Data = append(cacheData.Data, event)
-		}
+		cacheData.Data = append(cacheData.Data, event)
+	}
+
+	// Do not replace the cached data with the result of a failed run
+	if !child.finished {
+		return nil, fmt.Errorf("collector %s run on %s failed", join.Name, node.HostName)
 	}
 
 	data, err := cacheData.Marshal()
@@ -86,5 +143,122 @@ func cacheRun(ctx *Context, collname string, keyFields []string, ttl time.Durati
 		return nil, err
 	}
 
-	return cache, ctx.txn.SetWithTTL(append(cachePrefix, []byte(collname+"/"+ctx.node.HostName)...), data, ttl)
+	now := time.Now()
+	updated, err := now.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the data past its TTL so it can be served while stale
+	name := join.Name + "/" + node.HostName
+	ttl := join.TTL + join.MaxStale
+
+	txn := Store.NewTxn(true)
+	defer txn.Discard()
+
+	if err = txn.SetWithTTL(append(cachePrefix, name...), data, ttl); err != nil {
+		return nil, err
+	}
+	if err = txn.SetWithTTL(append(cacheTimePrefix, name...), updated, ttl); err != nil {
+		return nil, err
+	}
+	if err = txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	entry = newCacheEntry(cacheData.Data, now)
+	joinCache.set(name, entry)
+	return entry, nil
+}
+
+// refreshGroup deduplicates concurrent cache refreshes
+type refreshGroup struct {
+	mtx     sync.Mutex
+	ctx     context.Context    // Root context of the refreshes
+	cancel  context.CancelFunc // Cancels the running refreshes on shutdown
+	wg      sync.WaitGroup     // Tracks running refreshes for shutdown
+	flights map[string]*refreshFlight
+}
+
+func newRefreshGroup() (g *refreshGroup) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &refreshGroup{ctx: ctx, cancel: cancel, flights: map[string]*refreshFlight{}}
+}
+
+// refreshFlight is a running cache refresh
+type refreshFlight struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+// start returns the running refresh for the collector and node, starting one if needed
+func (g *refreshGroup) start(ctx *Context, node *Node, join *Join) (flight *refreshFlight) {
+	name := join.Name + "/" + node.HostName
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if flight, ok := g.flights[name]; ok {
+		return flight
+	}
+
+	flight = &refreshFlight{done: make(chan struct{})}
+	g.flights[name] = flight
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+		flight.entry, flight.err = cacheRun(g.ctx, ctx.timeout, ctx.nodes, node, join)
+		if flight.err != nil {
+			log.Warn("cache refresh failed",
+				"collector", join.Name, "node", node.HostName, "error", flight.err.Error())
+		}
+
+		g.mtx.Lock()
+		delete(g.flights, name)
+		g.mtx.Unlock()
+		close(flight.done)
+	}()
+
+	return flight
+}
+
+// do refreshes the cache waiting for the result while the calling context is active
+func (g *refreshGroup) do(ctx *Context, node *Node, join *Join) (entry *cacheEntry, err error) {
+	flight := g.start(ctx, node, join)
+
+	select {
+	case <-flight.done:
+		return flight.entry, flight.err
+	case <-ctx.ctx.Done():
+		return nil, ctx.ctx.Err()
+	}
+}
+
+// background refreshes the cache without waiting
+func (g *refreshGroup) background(ctx *Context, node *Node, join *Join) {
+	ctx.LogDebug("refreshing cache in background", "collector", join.Name, "cache_node", node.HostName)
+	g.start(ctx, node, join)
+}
+
+// stop cancels the running refreshes and waits for them to return within the given timeout
+func (g *refreshGroup) stop(timeout time.Duration) (ok bool) {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
@@ -2,40 +2,66 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"strings"
 
 	"github.com/brunotm/tact"
 	_ "github.com/brunotm/tact/collector/aix"
+	"github.com/brunotm/tact/collector/client/ssh"
 	_ "github.com/brunotm/tact/collector/linux"
 	_ "github.com/brunotm/tact/collector/oracle"
+	"github.com/brunotm/tact/collector/spec"
 	"github.com/brunotm/tact/log"
 	"github.com/brunotm/tact/scheduler"
 )
 
 var (
-	sched      = flag.Bool("sched", false, "Start scheduler")
-	cron       = flag.String("cron", "0 */1 * * * *", "Cron like scheduling expression: 0 */1 * * * *")
-	user       = flag.String("u", "", "user")
-	password   = flag.String("p", "", "password")
-	key        = flag.String("k", "", "ssh/sftp key file path")
-	hostName   = flag.String("n", "", "hostname")
-	netAddr    = flag.String("a", "", "network address")
-	logFiles   = flag.String("l", "", "log files, format name:path,name:path")
-	dbUser     = flag.String("dbuser", "", "log files, format name:path,name:path")
-	dbPassword = flag.String("dbpass", "", "log files, format name:path,name:path")
-	dbPort     = flag.String("dbport", "", "log files, format name:path,name:path")
-	collector  = flag.String("c", "", "Collector or group to run")
-	logLevel   = flag.String("log", "info", "Log level")
-	dataPath   = flag.String("datapath", "./statedb", "Path for state data")
+	sched       = flag.Bool("sched", false, "Start scheduler")
+	cron        = flag.String("cron", "", "Cron like scheduling expression: 0 */1 * * * *, the collector default if empty")
+	timeout     = flag.Duration("timeout", 0, "Run timeout, the collector default if zero")
+	user        = flag.String("u", "", "user")
+	password    = flag.String("p", "", "password")
+	key         = flag.String("k", "", "ssh/sftp key file path")
+	hostName    = flag.String("n", "", "hostname")
+	nodeType    = flag.String("t", "", "node type, eg. linux or aix")
+	discover    = flag.Bool("discover", false, "Detect the node type over ssh when not given")
+	netAddr     = flag.String("a", "", "network address")
+	logFiles    = flag.String("l", "", "log files, format name:path,name:path")
+	dbUser      = flag.String("dbuser", "", "log files, format name:path,name:path")
+	dbPassword  = flag.String("dbpass", "", "log files, format name:path,name:path")
+	dbPort      = flag.String("dbport", "", "log files, format name:path,name:path")
+	collector   = flag.String("c", "", "Collector or group to run")
+	logLevel    = flag.String("log", "info", "Log level")
+	dataPath    = flag.String("datapath", "./statedb", "Path for state data")
+	schema      = flag.Bool("schema", false, "Print the JSON Schema of the collector or group events and exit")
+	list        = flag.Bool("list", false, "List the collectors, or the collectors starting with the given collector or group, and exit")
+	graph       = flag.Bool("graph", false, "Print the dependency graph of the collector or group, or of all collectors, in DOT format and exit")
+	shutdown    = flag.Duration("shutdown", 60*time.Second, "Grace period for running jobs on shutdown")
+	include     = flag.String("include", "", "Deliver only events matching any pattern, format field=glob,field=glob")
+	exclude     = flag.String("exclude", "", "Drop events matching any pattern, format field=glob,field=glob")
+	fields      = flag.String("fields", "", "Deliver only the given fields, format field,field")
+	omit        = flag.String("omit", "", "Remove the given fields, format field,field")
+	rename      = flag.String("rename", "", "Rename fields, nested paths are dot separated, format field=name,field=name")
+	joinCache   = flag.Int("joincache", tact.DefaultJoinCacheSize>>20, "Size in MB of the in memory join cache shared by collectors")
+	specs       = flag.String("specs", "", "Directory with collector definitions in json or yaml files to register at startup")
+	specAPI     = flag.String("specapi", "", "Address to serve the API registering and scheduling collector definitions on when scheduling, eg. :8080")
+	hostKeyMode = flag.String("hostkeymode", ssh.HostKeyTOFU, "Default ssh host key verification: tofu, strict, pinned or ignore")
+	knownHosts  = flag.String("knownhosts", "", "known_hosts file for strict host key verification, the user known_hosts if empty")
+	hostKeys    = flag.String("hostkeys", "", "Manage the host keys trusted on first use and exit: list, accept=host[:port] or revoke=host[:port]")
+	reference   = flag.String("ref", "", "Import a reference table for joins from a csv or json file and exit, format name=path")
+	joinNodes   = flag.String("joinnodes", "", "JSON file with the array of nodes joins can run their collectors on, by host name")
 )
 
 func main() {
@@ -57,7 +83,72 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *specs != "" {
+		names, err := spec.RegisterDir(*specs)
+		if err != nil {
+			log.Error("registering collector definitions", "error", err.Error())
+			os.Exit(1)
+		}
+		log.Info("registered collector definitions", "collectors", names)
+	}
+
+	if err = tact.Registry.Validate(); err != nil {
+		log.Error("invalid collector registry", "error", err.Error())
+		os.Exit(1)
+	}
+
+	if *list {
+		listCollectors(os.Stdout, tact.Registry.Search(*collector))
+		return
+	}
+
+	if *graph {
+		var names []string
+		if *collector != "" {
+			if len(strings.Split(*collector, "/")) > 3 {
+				names = append(names, *collector)
+			} else {
+				group, err := tact.Registry.LookupGroup(*collector)
+				if err != nil {
+					log.Error("invalid collector", "error", err.Error())
+					os.Exit(1)
+				}
+				for _, c := range group {
+					names = append(names, c.Name)
+				}
+			}
+		}
+		if err = tact.Registry.WriteGraph(os.Stdout, names...); err != nil {
+			log.Error("writing graph", "error", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	tact.Init(*dataPath)
+	tact.SetJoinCacheSize(*joinCache << 20)
+
+	if err = ssh.SetHostKeyMode(*hostKeyMode, *knownHosts); err != nil {
+		log.Error("invalid host key verification", "error", err.Error())
+		tact.Close()
+		os.Exit(1)
+	}
+
+	if *hostKeys != "" {
+		if err = manageHostKeys(os.Stdout, *hostKeys); err != nil {
+			log.Error("managing host keys", "error", err.Error())
+		}
+		tact.Close()
+		return
+	}
+
+	if *reference != "" {
+		if err = importReference(*reference); err != nil {
+			log.Error("importing reference table", "error", err.Error())
+		}
+		tact.Close()
+		return
+	}
 
 	node := &tact.Node{}
 	node.HostName = *hostName
@@ -81,6 +172,7 @@ func main() {
 	node.DBUser = *dbUser
 	node.DBPassword = *dbPassword
 	node.DBPort = *dbPort
+	node.Type = *nodeType
 	node.LogFiles = make(map[string]string) // map[string]string{"messages": "/var/log/messages"}
 
 	if *logFiles != "" {
@@ -90,13 +182,34 @@ func main() {
 		}
 	}
 
+	if *discover && node.Type == "" {
+		if err = ssh.Discover(node, 30*time.Second); err != nil {
+			log.Error("discovering node type", "error", err.Error())
+			tact.Close()
+			os.Exit(1)
+		}
+		log.Info("discovered node type", "node", node.HostName, "type", node.Type, "os_version", node.OSVersion)
+	}
+
 	wchan := make(chan []byte)
+	wdone := make(chan struct{})
 	go func() {
+		defer close(wdone)
 		for e := range wchan {
 			fmt.Println(string(e))
 		}
 	}()
 
+	qchan := make(chan []byte)
+	qdone := make(chan struct{})
+	tact.Quarantine = qchan
+	go func() {
+		defer close(qdone)
+		for e := range qchan {
+			fmt.Fprintln(os.Stderr, string(e))
+		}
+	}()
+
 	if collector == nil {
 		panic("no colector specified")
 	}
@@ -104,43 +217,114 @@ func main() {
 	var coll *tact.Collector
 	var collGroup []*tact.Collector
 	if len(strings.Split(*collector, "/")) > 3 {
-		coll = tact.Registry.Get(*collector)
+		coll, err = tact.Registry.Lookup(*collector)
 	} else {
-		collGroup = tact.Registry.GetGroup(*collector)
+		collGroup, err = tact.Registry.LookupGroup(*collector)
+	}
+	if err != nil {
+		log.Error("invalid collector", "error", err.Error())
+		tact.Close()
+		os.Exit(1)
+	}
+
+	if *schema {
+		if coll != nil {
+			collGroup = append(collGroup, coll)
+		}
+		for _, c := range collGroup {
+			doc, err := c.JSONSchema()
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println(string(doc))
+		}
+		tact.Close()
+		return
+	}
+
+	filter, err := parseFilter()
+	if err != nil {
+		panic(err)
+	}
+
+	fieldMap, err := parseFieldMap()
+	if err != nil {
+		panic(err)
+	}
+
+	nodes, err := loadJoinNodes()
+	if err != nil {
+		panic(err)
 	}
 
 	if *sched {
 		sched := scheduler.New(100, 60*time.Second, wchan)
 
+		var opts []scheduler.JobOpt
+		if filter != nil {
+			opts = append(opts, scheduler.WithFilter(filter))
+		}
+		if fieldMap != nil {
+			opts = append(opts, scheduler.WithFieldMap(fieldMap))
+		}
+		if nodes != nil {
+			opts = append(opts, scheduler.WithNodes(nodes...))
+		}
+
 		if collGroup != nil {
-			for _, c := range collGroup {
-				if err = sched.AddJob(*cron, c, node, 290*time.Second); err != nil {
-					panic(err)
-				}
+			if err = sched.AddJobs(*cron, collGroup, node, *timeout, opts...); err != nil {
+				panic(err)
 			}
 		}
 
 		if coll != nil {
-			if err = sched.AddJob(*cron, coll, node, 290*time.Second); err != nil {
+			if err = sched.AddJob(*cron, coll, node, *timeout, opts...); err != nil {
 				panic(err)
 			}
 		}
 
 		sched.Start()
+
+		if *specAPI != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/collectors", spec.Handler(func(colls []*tact.Collector) (err error) {
+				return sched.AddJobs(*cron, colls, node, *timeout, opts...)
+			}))
+
+			go func() {
+				if err := http.ListenAndServe(*specAPI, mux); err != nil {
+					log.Error("serving collector definitions API", "error", err.Error())
+				}
+			}()
+		}
+
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		<-quit
-		sched.Stop()
+
+		log.Info("Stopping scheduler", "timeout_seconds", shutdown.Seconds())
+		abandoned, err := sched.Stop(*shutdown)
+		if len(abandoned) > 0 {
+			log.Warn("Abandoned running jobs", "jobs", abandoned)
+		}
+		if err != nil {
+			// Running jobs may still write to the channels and the store
+			log.Error("Stopping scheduler", "error", err.Error())
+			os.Exit(1)
+		}
 
 	} else {
 		var wg sync.WaitGroup
 
 		if collGroup != nil {
-			for _, c := range collGroup {
-				sess, err := tact.NewContext(context.Background(), c.Name, node, tact.Store, 290*time.Second)
+			for _, c := range tact.Applicable(collGroup, node) {
+				sess, err := tact.NewContext(context.Background(), c.Name, node, tact.Store, runTimeout(c))
 				if err != nil {
 					panic(err)
 				}
+				sess.SetFilter(filter)
+				sess.SetFieldMap(fieldMap)
+				sess.SetNodes(nodesByName(nodes))
 				wg.Add(1)
 				go func(c *tact.Collector) {
 					c.Start(sess, wchan)
@@ -149,11 +333,16 @@ func main() {
 			}
 		}
 
-		if coll != nil {
-			sess, err := tact.NewContext(context.Background(), *collector, node, tact.Store, 290*time.Second)
+		if coll != nil && coll.CheckNode(node) != nil {
+			log.Error("invalid collector for node", "error", coll.CheckNode(node).Error())
+		} else if coll != nil {
+			sess, err := tact.NewContext(context.Background(), *collector, node, tact.Store, runTimeout(coll))
 			if err != nil {
 				panic(err)
 			}
+			sess.SetFilter(filter)
+			sess.SetFieldMap(fieldMap)
+			sess.SetNodes(nodesByName(nodes))
 			wg.Add(1)
 			func() {
 				coll.Start(sess, wchan)
@@ -164,6 +353,188 @@ func main() {
 		wg.Wait()
 	}
 
+	// Stop the join cache refreshes still writing to the sinks,
+	// then drain pending events before closing the store
 	log.Info("Shutting down")
+	if err := tact.StopRefreshes(); err != nil {
+		log.Error("Stopping cache refreshes", "error", err.Error())
+		os.Exit(1)
+	}
+	close(wchan)
+	close(qchan)
+	<-wdone
+	<-qdone
 	tact.Close()
 }
+
+// runTimeout returns the run timeout from the command line, or the collector default
+func runTimeout(c *tact.Collector) (ttl time.Duration) {
+	if *timeout > 0 {
+		return *timeout
+	}
+	return c.Timeout
+}
+
+// listCollectors writes a table with the collectors metadata
+func listCollectors(w io.Writer, collectors []*tact.Collector) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCATEGORY\tPLATFORMS\tCREDENTIALS\tSCHEDULE\tTIMEOUT\tDESCRIPTION")
+	for _, c := range collectors {
+		platforms := strings.Join(c.Platforms, ",")
+		if platforms == "" {
+			platforms = "any"
+		}
+
+		credentials := make([]string, len(c.Credentials))
+		for i := range c.Credentials {
+			credentials[i] = string(c.Credentials[i])
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Name, c.Category, platforms,
+			strings.Join(credentials, ","), c.Schedule, c.Timeout, c.Description)
+	}
+	tw.Flush()
+}
+
+// manageHostKeys lists, accepts or revokes the host keys trusted on first use
+func manageHostKeys(w io.Writer, spec string) (err error) {
+	els := strings.SplitN(spec, "=", 2)
+
+	switch {
+	case els[0] == "list":
+		keys, err := ssh.HostKeys()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ADDRESS\tTYPE\tFINGERPRINT\tADDED")
+		for _, key := range keys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", key.Address, key.Type, key.Fingerprint, key.Added.Format(time.RFC3339))
+		}
+		return tw.Flush()
+
+	case els[0] == "accept" && len(els) == 2:
+		key, err := ssh.AcceptHostKey(els[1], 30*time.Second)
+		if err != nil {
+			return err
+		}
+		log.Info("accepted host key", "address", key.Address, "fingerprint", key.Fingerprint)
+		return nil
+
+	case els[0] == "revoke" && len(els) == 2:
+		if err = ssh.RevokeHostKey(els[1]); err != nil {
+			return err
+		}
+		log.Info("revoked host key", "address", els[1])
+		return nil
+	}
+
+	return fmt.Errorf("invalid host keys command %q, format list, accept=host[:port] or revoke=host[:port]", spec)
+}
+
+// parseFilter builds the job filter from the command line flags, nil if none was given
+func parseFilter() (filter *tact.Filter, err error) {
+	if *include == "" && *exclude == "" && *fields == "" && *omit == "" {
+		return nil, nil
+	}
+
+	filter = &tact.Filter{}
+	if filter.Include, err = parsePredicates(*include); err != nil {
+		return nil, err
+	}
+	if filter.Exclude, err = parsePredicates(*exclude); err != nil {
+		return nil, err
+	}
+	if *fields != "" {
+		filter.Fields = strings.Split(*fields, ",")
+	}
+	if *omit != "" {
+		filter.OmitFields = strings.Split(*omit, ",")
+	}
+	return filter, filter.Compile()
+}
+
+// importReference imports the reference table from a name=path spec, the format is taken from the file extension
+func importReference(spec string) (err error) {
+	els := strings.SplitN(spec, "=", 2)
+	if len(els) != 2 {
+		return fmt.Errorf("invalid reference %q, format name=path", spec)
+	}
+
+	file, err := os.Open(els[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format := tact.ReferenceJSON
+	if strings.HasSuffix(strings.ToLower(els[1]), ".csv") {
+		format = tact.ReferenceCSV
+	}
+
+	n, err := tact.ImportReference(els[0], format, file)
+	if err != nil {
+		return err
+	}
+	log.Info("imported reference table", "name", els[0], "records", n)
+	return nil
+}
+
+// parseFieldMap builds the job field renames from the command line flags, nil if none was given
+func parseFieldMap() (fieldMap *tact.FieldMap, err error) {
+	if *rename == "" {
+		return nil, nil
+	}
+
+	fieldMap = &tact.FieldMap{Renames: map[string]string{}}
+	for _, entry := range strings.Split(*rename, ",") {
+		els := strings.SplitN(entry, "=", 2)
+		if len(els) != 2 {
+			return nil, fmt.Errorf("invalid rename %q, format field=name", entry)
+		}
+		fieldMap.Renames[els[0]] = els[1]
+	}
+	return fieldMap, fieldMap.Compile()
+}
+
+// parsePredicates parses field=glob,field=glob into glob predicates
+func parsePredicates(spec string) (predicates []*tact.Predicate, err error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		els := strings.SplitN(entry, "=", 2)
+		if len(els) != 2 {
+			return nil, fmt.Errorf("invalid filter %q, format field=glob", entry)
+		}
+		predicates = append(predicates, &tact.Predicate{Field: els[0], Op: tact.OpGlob, Value: els[1]})
+	}
+	return predicates, nil
+}
+
+// loadJoinNodes reads the nodes joins can run their collectors on, nil if no file was given
+func loadJoinNodes() (nodes []*tact.Node, err error) {
+	if *joinNodes == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(*joinNodes)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &nodes); err != nil {
+		return nil, fmt.Errorf("invalid join nodes %s: %s", *joinNodes, err)
+	}
+	return nodes, nil
+}
+
+// nodesByName indexes the join nodes by host name
+func nodesByName(nodes []*tact.Node) (byName map[string]*tact.Node) {
+	byName = make(map[string]*tact.Node, len(nodes))
+	for _, node := range nodes {
+		byName[node.HostName] = node
+	}
+	return byName
+}
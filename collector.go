@@ -12,11 +12,20 @@ type PostEventOpsFn func([]byte) (out []byte, err error)
 
 // Collector implements the base collector and main routines
 type Collector struct {
-	Name     string
-	GetData  GetDataFn
-	EventOps *EventOps
-	Joins    []*Join
-	PostOps  PostEventOpsFn
+	Name        string
+	Description string // Short description of the collected data
+	Category    Category
+	Platforms   []string      // Supported node types, any if empty
+	Credentials []Credential  // Node credentials required to run
+	Schedule    string        // Default cron like schedule, DefaultSchedule if empty
+	Timeout     time.Duration // Default run timeout, DefaultTimeout if zero
+	GetData     GetDataFn
+	EventOps    *EventOps
+	Joins       []*Join
+	PostOps     []*PostOp // Post processing chain applied in order after the event ops
+	Schema      *Schema
+	Filter      *Filter  // Events and fields delivered for all jobs, narrowed by any job filter
+	Tags        []string // Free form tags for registry searches, eg. storage
 }
 
 // Start this collector with given ctxion and write channel
@@ -30,6 +39,19 @@ func (c *Collector) Start(ctx *Context, writeCh chan<- []byte) {
 		return
 	}
 
+	// Per run aggregation state. Join caches hold the raw events only
+	var aggregators []*aggregator
+	var dropRaw bool
+	if c.EventOps != nil && !ctx.joinCache {
+		for _, agg := range c.EventOps.Aggregates {
+			aggregators = append(aggregators, newAggregator(agg))
+			dropRaw = dropRaw || agg.Drop
+		}
+	}
+
+	// Per run join match counters
+	joinStats := make([]JoinStats, len(c.Joins))
+
 	events := c.GetData(ctx)
 
 	for {
@@ -48,7 +70,12 @@ func (c *Collector) Start(ctx *Context, writeCh chan<- []byte) {
 		case event, running := <-events:
 
 			if !running {
-				ctx.done()
+				c.sendSummaries(ctx, aggregators, writeCh)
+				c.logJoinStats(ctx, joinStats)
+				if err = ctx.done(); err != nil {
+					ctx.LogError("committing session data", "error", err)
+					return
+				}
 				ctx.LogInfo("finished successfully")
 				return
 			}
@@ -69,17 +96,51 @@ func (c *Collector) Start(ctx *Context, writeCh chan<- []byte) {
 
 			// Do any specified postOps
 			if c.PostOps != nil {
-				newEvent, err := c.PostOps(event)
-				if err != nil {
-					ctx.LogError("post ops error: %s, event: %s", err.Error(), string(event))
+				if event = c.postProcess(ctx, event); event == nil {
+					continue
+				}
+			}
+
+			// Validate the event against the collector schema
+			if c.Schema != nil {
+				if event = c.Schema.validate(ctx, event); event == nil {
 					continue
 				}
-				event = newEvent
 			}
 
 			// Do any specified data joins
-			for _, join := range c.Joins {
-				event, _ = join.Process(ctx, event)
+			var ok bool
+			for i, join := range c.Joins {
+				if event, ok = join.apply(ctx, event); ok {
+					joinStats[i].Hits++
+				} else {
+					joinStats[i].Misses++
+				}
+				if event == nil {
+					break
+				}
+			}
+			if event == nil {
+				continue
+			}
+
+			// Filter the events selected by the collector and job
+			if !c.selected(ctx, event) {
+				continue
+			}
+
+			// Aggregate the event for the run summaries
+			for _, agg := range aggregators {
+				agg.observe(event)
+			}
+			if dropRaw {
+				continue
+			}
+
+			// Project the selected fields and map the field names for the job
+			if event, err = c.project(ctx, event); err != nil {
+				ctx.LogError("field map error", "error", err)
+				continue
 			}
 
 			// Enrich event with metadata from config and deliver to ctxion wchan
@@ -91,11 +152,76 @@ func (c *Collector) Start(ctx *Context, writeCh chan<- []byte) {
 	}
 }
 
+// project applies the collector and job field projections and the job field map to the event
+func (c *Collector) project(ctx *Context, event []byte) (out []byte, err error) {
+	if c.Filter != nil {
+		event = c.Filter.Project(event)
+	}
+	if ctx.filter != nil {
+		event = ctx.filter.Project(event)
+	}
+	if ctx.fieldMap != nil {
+		return ctx.fieldMap.Apply(event)
+	}
+	return event, nil
+}
+
+// selected checks the event against the collector and job filters
+func (c *Collector) selected(ctx *Context, event []byte) (ok bool) {
+	if c.Filter != nil && !c.Filter.Match(event) {
+		return false
+	}
+	if ctx.filter != nil && !ctx.filter.Match(event) {
+		return false
+	}
+	return true
+}
+
+// logJoinStats reports the joins that missed events in this run
+func (c *Collector) logJoinStats(ctx *Context, stats []JoinStats) {
+	for i, join := range c.Joins {
+		switch {
+		case stats[i].Misses == 0:
+		case stats[i].Hits == 0 && len(ctx.cache[join.cacheName()]) > 0:
+			// The joined collector has data but none matched
+			ctx.LogWarn("join matched no events", "join", join.Name, "misses", stats[i].Misses)
+		default:
+			ctx.LogDebug("join missed events", "join", join.Name,
+				"hits", stats[i].Hits, "misses", stats[i].Misses)
+		}
+	}
+}
+
+// sendSummaries delivers the aggregated summaries for this run,
+// projected and mapped for the job as the raw events
+func (c *Collector) sendSummaries(ctx *Context, aggregators []*aggregator, writeCh chan<- []byte) {
+	for _, agg := range aggregators {
+		summaries, err := agg.summaries()
+		if err != nil {
+			ctx.LogError("building summaries", "aggregate", agg.Name, "error", err)
+			continue
+		}
+
+		for _, event := range summaries {
+			if event, err = c.project(ctx, event); err != nil {
+				ctx.LogError("field map error", "aggregate", agg.Name, "error", err)
+				continue
+			}
+
+			event = ctx.enrichMetric(event, ctx.name+"/"+agg.Name)
+			if !WrapCtxSend(ctx.ctx, writeCh, event) {
+				ctx.LogError("timeout sending event to writer")
+				return
+			}
+		}
+	}
+}
+
 func (c *Collector) buildRunCache(ctx *Context) (err error) {
 	if len(c.Joins) > 0 {
 		for _, join := range c.Joins {
-			ctx.LogDebug("building join cache", "name", join.Name)
-			if _, ok := ctx.cache[join.Name]; !ok {
+			ctx.LogDebug("building join cache", "name", join.cacheName())
+			if _, ok := ctx.cache[join.cacheName()]; !ok {
 				err := join.loadData(ctx)
 				if err != nil {
 					return err
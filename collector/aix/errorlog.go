@@ -20,8 +20,11 @@ func init() {
 }
 
 var errorLog = &tact.Collector{
-	Name:    "/aix/log/error",
-	GetData: errorLogFn,
+	Name:        "/aix/log/error",
+	Description: "System error log entries from errpt",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     errorLogFn,
 }
 
 // Example raw data
@@ -19,36 +19,40 @@ func init() {
 }
 
 var fcStat = &tact.Collector{
-	Name:    "/aix/performance/fcstat",
-	GetData: fcStatFn,
+	Name:        "/aix/performance/fcstat",
+	Description: "Fibre channel adapter traffic and errors from fcstat",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Tags:        []string{"storage"},
+	GetData:     fcStatFn,
 	EventOps: &tact.EventOps{
 		Round: 2,
+		Units: map[string]tact.Unit{
+			"avg_fc_megabytes_rx": tact.Bytes,
+			"avg_fc_megabytes_tx": tact.Bytes,
+		},
 		Delta: &tact.DeltaOps{
-			TTL:      time.Hour * 3,
-			KeyField: "device",
-			Rate:     true,
-			Blacklist: tact.BuildBlackList(
-				"device",
-				"serial_number",
-				"wwpn",
-				"speed_sup_gbit",
-				"speed_run_gbit",
-				"fcid",
-				"last_reset_sec"),
-			RateBlacklist: tact.BuildBlackList(
-				"num_lip_count",
-				"num_nos_count",
-				"num_frames_error",
-				"num_frames_dumped",
-				"num_link_fail",
-				"num_sync_loss",
-				"num_prim_seq_error",
-				"num_invalid_tx_word",
-				"num_invalid_crc",
-				"num_fc_no_dma_res",
-				"num_fc_no_adapt_element",
-				"num_fc_no_cmd_res",
-				"num_fc_cntrl_req"),
+			TTL:        time.Hour * 3,
+			KeyField:   "device",
+			Rate:       true,
+			ResetField: "last_reset_seconds",
+			Fields: map[string]tact.DeltaMode{
+				"speed_sup_gbit":          tact.DeltaGauge,
+				"speed_run_gbit":          tact.DeltaGauge,
+				"num_lip_count":           tact.DeltaCounter,
+				"num_nos_count":           tact.DeltaCounter,
+				"num_frames_error":        tact.DeltaCounter,
+				"num_frames_dumped":       tact.DeltaCounter,
+				"num_link_fail":           tact.DeltaCounter,
+				"num_sync_loss":           tact.DeltaCounter,
+				"num_prim_seq_error":      tact.DeltaCounter,
+				"num_invalid_tx_word":     tact.DeltaCounter,
+				"num_invalid_crc":         tact.DeltaCounter,
+				"num_fc_no_dma_res":       tact.DeltaCounter,
+				"num_fc_no_adapt_element": tact.DeltaCounter,
+				"num_fc_no_cmd_res":       tact.DeltaCounter,
+				"num_fc_cntrl_req":        tact.DeltaCounter,
+			},
 		},
 	},
 }
@@ -82,10 +86,8 @@ var fcStatParser = rexon.MustNewParser(
 		rexon.MustNewValue("avg_fc_read_req", rexon.Number, rexon.ValueRegex(`Input\s+Requests:\s+(\d+)`)),
 		rexon.MustNewValue("avg_fc_write_req", rexon.Number, rexon.ValueRegex(`Output\s+Requests:\s+(\d+)`)),
 		rexon.MustNewValue("num_fc_cntrl_req", rexon.Number, rexon.ValueRegex(`Control\s+Requests:\s+(\d+)`)),
-		rexon.MustNewValue("avg_fc_megabytes_rx", rexon.DigitalUnit, rexon.ValueRegex(`Input\s+Bytes:\s+(\d+)`),
-			rexon.ToFormat("mb")),
-		rexon.MustNewValue("avg_fc_megabytes_tx", rexon.DigitalUnit, rexon.ValueRegex(`Output\s+Bytes:\s+(\d+)`),
-			rexon.ToFormat("mb")),
+		rexon.MustNewValue("avg_fc_megabytes_rx", rexon.Number, rexon.ValueRegex(`Input\s+Bytes:\s+(\d+)`)),
+		rexon.MustNewValue("avg_fc_megabytes_tx", rexon.Number, rexon.ValueRegex(`Output\s+Bytes:\s+(\d+)`)),
 	},
 	rexon.StartTag(`FIBRE\s+CHANNEL\s+STATISTICS\s+REPORT:\s+(\w+)`),
 	rexon.SkipTag(`IP\s+over\s+FC\s+Traffic\s+Statistics`),
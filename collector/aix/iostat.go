@@ -18,8 +18,12 @@ func init() {
 }
 
 var ioStat = &tact.Collector{
-	Name:    "/aix/performance/iostat",
-	GetData: ioStatFn,
+	Name:        "/aix/performance/iostat",
+	Description: "Disk IO rates, throughput and service times from iostat",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Tags:        []string{"storage"},
+	GetData:     ioStatFn,
 	Joins: []*tact.Join{
 		{
 			TTL:          3 * time.Hour,
@@ -16,8 +16,13 @@ func init() {
 }
 
 var lspv = &tact.Collector{
-	Name:    "/aix/config/lspv",
-	GetData: lspvFn,
+	Name:        "/aix/config/lspv",
+	Description: "Physical volumes and volume groups from lspv",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Schedule:    "0 0 */1 * * *",
+	Tags:        []string{"storage"},
+	GetData:     lspvFn,
 }
 
 var lspvParser = rexon.MustNewParser(
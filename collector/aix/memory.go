@@ -18,8 +18,32 @@ func init() {
 
 // System memory collector
 var memory = &tact.Collector{
-	Name:    "/aix/performance/memory",
-	GetData: memoryFn,
+	Name:        "/aix/performance/memory",
+	Description: "System memory and paging space usage from svmon",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     memoryFn,
+	Schema: &tact.Schema{
+		Invalid: tact.InvalidQuarantine,
+		Fields: []*tact.Field{
+			{Name: "mem_size_mb", Type: tact.FieldNumber, Unit: "MB", Required: true, Description: "Real memory size"},
+			{Name: "mem_used_mb", Type: tact.FieldNumber, Unit: "MB", Required: true, Description: "Real memory in use"},
+			{Name: "mem_free_mb", Type: tact.FieldNumber, Unit: "MB", Required: true, Description: "Real memory free"},
+			{Name: "mem_pin_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Real memory pinned"},
+			{Name: "mem_virtual_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Virtual memory in use"},
+			{Name: "mem_avail_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Real memory available"},
+			{Name: "mem_mode", Type: tact.FieldString, Description: "Memory mode"},
+			{Name: "swap_size_mb", Type: tact.FieldNumber, Unit: "MB", Required: true, Description: "Paging space size"},
+			{Name: "swap_used_mb", Type: tact.FieldNumber, Unit: "MB", Required: true, Description: "Paging space in use"},
+			{Name: "pin_work_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Working segment pinned memory"},
+			{Name: "pin_pers_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Persistent segment pinned memory"},
+			{Name: "pin_clnt_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Client segment pinned memory"},
+			{Name: "pin_other_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Other pinned memory"},
+			{Name: "used_work_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Working segment memory in use"},
+			{Name: "used_pers_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Persistent segment memory in use"},
+			{Name: "used_clnt_mb", Type: tact.FieldNumber, Unit: "MB", Description: "Client segment memory in use"},
+		},
+	},
 }
 
 // System memory parser
@@ -100,8 +124,11 @@ func memoryFn(ctx *tact.Context) (events <-chan []byte) {
 
 // User memory collector
 var memoryUser = &tact.Collector{
-	Name:    "/aix/performance/memory_user",
-	GetData: memoryUserFn,
+	Name:        "/aix/performance/memory_user",
+	Description: "Memory usage by user from svmon",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     memoryUserFn,
 }
 
 // User memory parser
@@ -15,6 +15,11 @@ func init() {
 }
 
 var storage = &tact.Collector{
-	Name:    "/aix/config/storage",
-	GetData: common.NewUnixEMCStorageFn(inqPath, inqRex),
+	Name:        "/aix/config/storage",
+	Description: "Storage array devices from EMC inq",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Schedule:    "0 0 */1 * * *",
+	Tags:        []string{"storage"},
+	GetData:     common.NewUnixEMCStorageFn(inqPath, inqRex),
 }
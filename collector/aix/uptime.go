@@ -10,6 +10,9 @@ func init() {
 }
 
 var upTime = &tact.Collector{
-	Name:    "/aix/performance/uptime",
-	GetData: common.NewUnixUptimeFn(),
+	Name:        "/aix/performance/uptime",
+	Description: "System uptime and load averages",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     common.NewUnixUptimeFn(),
 }
@@ -16,8 +16,11 @@ func init() {
 }
 
 var vmStat = &tact.Collector{
-	Name:    "/aix/performance/vmstat",
-	GetData: vmStatFn,
+	Name:        "/aix/performance/vmstat",
+	Description: "Memory, paging and CPU utilization from vmstat",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     vmStatFn,
 }
 
 var vmStatParser = rexon.MustNewParser(
@@ -15,8 +15,11 @@ func init() {
 }
 
 var wlmStat = &tact.Collector{
-	Name:    "/aix/performance/wlmstat",
-	GetData: wlmStatFn,
+	Name:        "/aix/performance/wlmstat",
+	Description: "CPU, memory and disk IO by workload manager class from wlmstat",
+	Platforms:   []string{tact.PlatformAIX},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     wlmStatFn,
 }
 
 var wlmStatParser = rexon.MustNewParser(
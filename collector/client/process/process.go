@@ -0,0 +1,141 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/brunotm/tact"
+	"github.com/brunotm/tact/js"
+)
+
+// Request is the JSON document written to the helper process stdin
+type Request struct {
+	Collector      string     `json:"collector"`
+	Node           *tact.Node `json:"node"`
+	TimeoutSeconds float64    `json:"timeout_seconds"`
+	LastRunTime    time.Time  `json:"last_run_time"`
+	CurrentRunTime time.Time  `json:"current_run_time"`
+}
+
+// Collector returns a collector function running the given local helper program.
+// The helper receives a Request as JSON on stdin, including the node credentials,
+// and must write the events as newline delimited JSON objects to stdout.
+// Lines written to stderr are logged. The helper and its children are killed when the run is cancelled
+func Collector(path string, args ...string) tact.GetDataFn {
+	return func(ctx *tact.Context) (events <-chan []byte) {
+		return Run(ctx, path, args...)
+	}
+}
+
+// Run executes the given local helper program and streams its events
+func Run(ctx *tact.Context, path string, args ...string) (events <-chan []byte) {
+	outCh := make(chan []byte)
+	go run(ctx, path, args, outCh)
+	return outCh
+}
+
+func run(ctx *tact.Context, path string, args []string, outCh chan<- []byte) {
+	defer close(outCh)
+
+	request, err := json.Marshal(&Request{
+		Collector:      ctx.Name(),
+		Node:           ctx.Node(),
+		TimeoutSeconds: ctx.Timeout().Seconds(),
+		LastRunTime:    ctx.LastRunTime(),
+		CurrentRunTime: ctx.CurrentRunTime(),
+	})
+	if err != nil {
+		ctx.LogError("process: encoding request", "error", err.Error())
+		return
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(request)
+	// Run the helper in its own process group so its children can be killed with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		ctx.LogError("process: creating stdout pipe", "error", err.Error())
+		return
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		ctx.LogError("process: creating stderr pipe", "error", err.Error())
+		return
+	}
+
+	if err = cmd.Start(); err != nil {
+		ctx.LogError("process: starting helper", "path", path, "error", err.Error())
+		return
+	}
+
+	exited := make(chan struct{})
+	go killGroup(ctx, cmd.Process.Pid, exited)
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		logStderr(ctx, path, stderr)
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if js.GetType(line) != js.Object {
+				ctx.LogError("process: invalid event", "path", path, "event", string(line))
+			} else if !tact.WrapCtxSend(ctx.Context(), outCh, line) {
+				ctx.LogError("process: timed out sending event to upstream processing")
+				break
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ctx.LogError("process: reading helper output", "path", path, "error", err.Error())
+			break
+		}
+	}
+
+	// Drain the output so the helper is not blocked on a full pipe when we stop early
+	io.Copy(ioutil.Discard, stdout)
+	<-logged
+
+	err = cmd.Wait()
+	close(exited)
+	if err != nil {
+		ctx.LogError("process: helper failed", "path", path, "error", err.Error())
+	}
+}
+
+// killGroup kills the helper process group if the run is cancelled before the helper exits
+func killGroup(ctx *tact.Context, pid int, exited <-chan struct{}) {
+	select {
+	case <-ctx.Context().Done():
+		syscall.Kill(-pid, syscall.SIGKILL)
+	case <-exited:
+	}
+}
+
+// logStderr logs the helper stderr lines
+func logStderr(ctx *tact.Context, path string, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		ctx.LogWarn("process: helper stderr", "path", path, "message", scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		ctx.LogWarn("process: reading helper stderr", "path", path, "error", err.Error())
+	}
+
+	// Drain the rest, as on lines too long, so the helper is not blocked on a full pipe
+	io.Copy(ioutil.Discard, stderr)
+}
@@ -2,40 +2,11 @@ package sftp
 
 import (
 	"github.com/brunotm/rexon"
-	"github.com/brunotm/sshmgr/manager"
 	"github.com/brunotm/tact"
 	"github.com/brunotm/tact/collector/client/ssh"
 	"github.com/brunotm/tact/js"
 )
 
-// File represents a remotely open file
-// type File struct {
-// 	*sftp.File
-// 	s *sshmgr.SFTPctx
-// }
-
-// Close both file and sftp client ctx
-// func (f *File) Close() (err error) {
-// 	defer f.s.Close()
-// 	return f.File.Close()
-// }
-
-// Open opens and returns the given file in RO mode
-// func Open(ctx *tact.Context, filePath string) (file *File, err error) {
-// 	// Get a sftp ctx for the host from the manager
-// 	client, err := sshmgr.Manager.GetSFTPctx(ssh.NewSSHNodeConfig(ctx))
-// 	if err != nil {
-// 		return nil, fmt.Errorf("sftp: error getting sftp ctx: %s", err.Error())
-// 	}
-
-// 	// Open the remote file for reading, defaults to O_RDONLY
-// 	f, err := sftpctx.Open(filePath)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("sftp: opening file %s: %s", filePath, err.Error())
-// 	}
-// 	return &File{File: f, s: sftpctx}, nil
-// }
-
 // Regex opens the given file and parses with the provided parser remembering the last read line
 func Regex(ctx *tact.Context, fileName string, rex rexon.DataParser) (events <-chan []byte) {
 	outCh := make(chan []byte)
@@ -54,7 +25,7 @@ func regex(ctx *tact.Context, fileName string, rex rexon.DataParser, outCh chan<
 	}
 
 	// Get a sftp ctx for the host from the manager
-	client, err := manager.SFTPClient(ssh.NewSSHNodeConfig(ctx))
+	client, err := ssh.SFTPClient(ctx)
 	if err != nil {
 		ctx.LogError("sftp: error getting sftp ctx: %s", err)
 		return
@@ -0,0 +1,267 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/brunotm/tact"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// connTTL is how long an unreferenced connection is kept open for reuse
+	connTTL = 10 * time.Second
+	// dialTimeout is the node tcp connection timeout
+	dialTimeout = 5 * time.Second
+)
+
+var (
+	connMtx   sync.Mutex
+	conns     = map[string]*Conn{}       // Shared connections by node credentials and host key settings
+	connLocks = map[string]*sync.Mutex{} // Serializes connecting to the same node with the same settings
+)
+
+// Conn is a shared ssh connection to a node whose host key was verified in the connection handshake.
+// Connections are reference counted and closed when unreferenced for a few seconds
+type Conn struct {
+	id       string
+	client   *ssh.Client
+	conn     net.Conn
+	refs     int
+	atime    time.Time
+	deadline time.Time // Connection deadline, the latest of its users deadlines
+}
+
+// SFTPConn is a sftp session over a shared ssh connection
+type SFTPConn struct {
+	*sftp.Client
+	conn *Conn
+}
+
+// Close the sftp session and release the connection
+func (s *SFTPConn) Close() (err error) {
+	err = s.Client.Close()
+	s.conn.Close()
+	return err
+}
+
+// Close releases the connection
+func (c *Conn) Close() (err error) {
+	connMtx.Lock()
+	defer connMtx.Unlock()
+
+	if c.refs == 0 {
+		return fmt.Errorf("ssh: connection already closed")
+	}
+
+	c.refs--
+	c.atime = time.Now()
+	if c.refs == 0 {
+		atime := c.atime
+		time.AfterFunc(connTTL, func() { c.expire(atime) })
+	}
+	return nil
+}
+
+// CombinedOutput runs cmd on the remote host and returns its combined standard output and standard error
+func (c *Conn) CombinedOutput(cmd string, envs map[string]string) (data []byte, err error) {
+	s, err := c.session(envs)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	return s.CombinedOutput(cmd)
+}
+
+// CombinedReader is like CombinedOutput but returns a io.ReadCloser combining both stdout and stderr.
+// Closing the reader closes the session
+func (c *Conn) CombinedReader(cmd string, envs map[string]string) (reader io.ReadCloser, err error) {
+	s, err := c.session(envs)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := s.StdoutPipe()
+	if err == nil {
+		var stderr io.Reader
+		if stderr, err = s.StderrPipe(); err == nil {
+			if err = s.Start(cmd); err == nil {
+				return readCloser{Reader: io.MultiReader(stdout, stderr), s: s}, nil
+			}
+		}
+	}
+
+	s.Close()
+	return nil, err
+}
+
+// session creates a new session with the given environment
+func (c *Conn) session(envs map[string]string) (s *ssh.Session, err error) {
+	if s, err = c.client.NewSession(); err != nil {
+		return nil, err
+	}
+
+	for name := range envs {
+		if err = s.Setenv(name, envs[name]); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// expire closes and removes the connection if it was not used since the given access time
+func (c *Conn) expire(atime time.Time) {
+	connMtx.Lock()
+	defer connMtx.Unlock()
+
+	if c.refs > 0 || !c.atime.Equal(atime) {
+		return
+	}
+	if conns[c.id] == c {
+		delete(conns, c.id)
+	}
+	c.client.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	s *ssh.Session
+}
+
+func (r readCloser) Close() (err error) {
+	return r.s.Close()
+}
+
+// extendDeadline extends the connection deadline to the given duration from now.
+// The deadline is shared by all the connection users, so it is never shortened
+func (c *Conn) extendDeadline(d time.Duration) {
+	connMtx.Lock()
+	defer connMtx.Unlock()
+
+	if deadline := time.Now().Add(d); deadline.After(c.deadline) {
+		c.deadline = deadline
+		c.conn.SetDeadline(deadline)
+	}
+}
+
+// connect returns a shared connection to the node, connecting if there is none or it is no longer usable.
+// The connection deadline is extended to the given duration from now
+func connect(node *tact.Node, deadline time.Duration) (c *Conn, err error) {
+	id := connID(node)
+
+	connMtx.Lock()
+	lock := connLocks[id]
+	if lock == nil {
+		lock = &sync.Mutex{}
+		connLocks[id] = lock
+	}
+	connMtx.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	connMtx.Lock()
+	if c = conns[id]; c != nil {
+		c.refs++
+	}
+	connMtx.Unlock()
+
+	if c != nil {
+		if _, _, err = c.client.SendRequest("keepalive@tact", true, nil); err == nil {
+			c.extendDeadline(deadline)
+			return c, nil
+		}
+
+		connMtx.Lock()
+		c.refs--
+		delete(conns, id)
+		connMtx.Unlock()
+		c.client.Close()
+	}
+
+	if c, err = dial(node, deadline); err != nil {
+		return nil, err
+	}
+	c.id = id
+	c.refs = 1
+
+	connMtx.Lock()
+	conns[id] = c
+	connMtx.Unlock()
+	return c, nil
+}
+
+// dial connects and authenticates to the node, verifying the host key in the handshake.
+// The connection deadline is set to the given duration
+func dial(node *tact.Node, deadline time.Duration) (c *Conn, err error) {
+	config, err := clientConfig(node)
+	if err != nil {
+		return nil, err
+	}
+
+	address := hostAddress(node)
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(deadline)
+	conn.SetDeadline(expires)
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{client: ssh.NewClient(sshConn, chans, reqs), conn: conn, deadline: expires}, nil
+}
+
+// clientConfig creates the ssh client configuration for the node
+func clientConfig(node *tact.Node) (config *ssh.ClientConfig, err error) {
+	if node.SSHUser == "" {
+		return nil, fmt.Errorf("ssh: empty user for %s", node.HostName)
+	}
+	if node.SSHPassword == "" && len(node.SSHKey) == 0 {
+		return nil, fmt.Errorf("ssh: empty password and key for %s", node.HostName)
+	}
+
+	config = &ssh.ClientConfig{}
+	config.SetDefaults()
+	config.User = node.SSHUser
+	config.Timeout = dialTimeout
+
+	if node.SSHPassword != "" {
+		config.Auth = append(config.Auth, ssh.Password(node.SSHPassword))
+	}
+	if len(node.SSHKey) > 0 {
+		key, err := ssh.ParsePrivateKey(node.SSHKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(key))
+	}
+
+	if config.HostKeyAlgorithms, config.HostKeyCallback, err = hostKeyCallback(node); err != nil {
+		return nil, err
+	}
+
+	// Reverse the order of the available ciphers to prevent early failures
+	// in the negotiation with older ssh server versions
+	for i := len(config.Ciphers)/2 - 1; i >= 0; i-- {
+		opp := len(config.Ciphers) - 1 - i
+		config.Ciphers[i], config.Ciphers[opp] = config.Ciphers[opp], config.Ciphers[i]
+	}
+	return config, nil
+}
+
+// connID identifies connections by node credentials and host key settings
+func connID(node *tact.Node) (id string) {
+	mode, _ := nodeHostKeyMode(node)
+	return tact.Hash([]byte(fmt.Sprint(node.SSHUser, hostAddress(node),
+		node.SSHPassword, node.SSHKey, mode, node.SSHHostKey)))
+}
@@ -0,0 +1,489 @@
+package ssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brunotm/tact"
+	"github.com/brunotm/tact/log"
+	"github.com/brunotm/tact/storage"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key verification modes
+const (
+	HostKeyTOFU   = "tofu"   // Trust the key on first use and record it in the Store, fail if it changes
+	HostKeyStrict = "strict" // The key must be in the known_hosts file
+	HostKeyPinned = "pinned" // The key must match the node SSHHostKey fingerprint or public key
+	HostKeyIgnore = "ignore" // No verification
+)
+
+const (
+	// verifiedTTL is how long a verified host key is trusted before verifying it again
+	verifiedTTL = 5 * time.Minute
+)
+
+var (
+	hostKeyPrefix = []byte(`hostkey/`)
+
+	hostKeyMtx      sync.Mutex
+	hostKeyMode     = HostKeyTOFU
+	knownHostsFile  = defaultKnownHosts()
+	verifiedHosts   = map[string]*verifiedKey{} // Recently verified keys by mode and address
+	errKeyCaptured  = errors.New("host key captured")
+	errProbeKey     = errors.New("probe key")
+	errNoKnownHosts = errors.New("no known_hosts file configured")
+)
+
+// HostKey is a host key trusted on first use
+type HostKey struct {
+	Address     string    `json:"address"`
+	Type        string    `json:"type"`
+	Fingerprint string    `json:"fingerprint"`
+	Key         string    `json:"key"` // Public key in authorized_keys format
+	Added       time.Time `json:"added"`
+}
+
+// verifiedKey is a recently verified host key
+type verifiedKey struct {
+	Type        string
+	Fingerprint string
+	Time        time.Time
+}
+
+// probeKey is a public key matching no known key
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "probe" }
+func (probeKey) Marshal() []byte                              { return []byte("probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errProbeKey }
+
+// HostKeyError is returned when a host key can not be verified
+type HostKeyError struct {
+	Address     string
+	Mode        string
+	Fingerprint string   // Fingerprint of the key presented by the host
+	Want        []string // Fingerprints of the trusted keys, empty if the host is unknown
+}
+
+func (e *HostKeyError) Error() string {
+	if len(e.Want) == 0 {
+		return fmt.Sprintf("ssh: unknown host key %s for %s (mode %s)", e.Fingerprint, e.Address, e.Mode)
+	}
+	return fmt.Sprintf("ssh: host key mismatch for %s (mode %s): got %s, want %s",
+		e.Address, e.Mode, e.Fingerprint, strings.Join(e.Want, ", "))
+}
+
+// SetHostKeyMode sets the default verification mode for nodes not defining one
+// and the known_hosts file used in strict mode, the user known_hosts if empty
+func SetHostKeyMode(mode, knownHosts string) (err error) {
+	if err = validHostKeyMode(mode); err != nil {
+		return err
+	}
+
+	hostKeyMtx.Lock()
+	defer hostKeyMtx.Unlock()
+
+	hostKeyMode = mode
+	if knownHosts != "" {
+		knownHostsFile = knownHosts
+	}
+	verifiedHosts = map[string]*verifiedKey{}
+	return nil
+}
+
+// hostKeyCallback returns the host key algorithms and the callback verifying the key presented in the
+// node connection handshake according to the node or default verification mode.
+// Keys verified in the last few minutes are trusted without reading the Store or known_hosts file
+func hostKeyCallback(node *tact.Node) (algorithms []string, callback ssh.HostKeyCallback, err error) {
+	mode, err := nodeHostKeyMode(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	address := hostAddress(node)
+
+	var pinned ssh.PublicKey
+	var known ssh.HostKeyCallback
+	var verified *verifiedKey
+
+	switch mode {
+	case HostKeyIgnore:
+		return nil, ssh.InsecureIgnoreHostKey(), nil
+
+	case HostKeyPinned:
+		if node.SSHHostKey == "" {
+			return nil, nil, fmt.Errorf("ssh: no pinned host key for %s", node.HostName)
+		}
+		// A pinned public key selects its algorithm, a fingerprint the default negotiated one
+		if pinned, _, _, _, err = ssh.ParseAuthorizedKey([]byte(node.SSHHostKey)); err == nil {
+			algorithms = []string{pinned.Type()}
+		}
+
+	case HostKeyStrict:
+		if verified = recentlyVerified(mode, address); verified != nil {
+			algorithms = []string{verified.Type}
+		} else if known, algorithms, err = knownHosts(address); err != nil {
+			return nil, nil, err
+		}
+
+	case HostKeyTOFU:
+		if verified = recentlyVerified(mode, address); verified != nil {
+			algorithms = []string{verified.Type}
+		} else {
+			stored, err := getHostKey(address)
+			if err != nil && err != storage.ErrKeyNotFound {
+				return nil, nil, err
+			}
+			if stored != nil {
+				algorithms = []string{stored.Type}
+			}
+		}
+	}
+
+	callback = func(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+		fingerprint := ssh.FingerprintSHA256(key)
+		if verified != nil && verified.Fingerprint == fingerprint {
+			return nil
+		}
+
+		switch mode {
+		case HostKeyPinned:
+			// Pins are per node, so pinned verifications are not shared
+			return verifyPinned(node, address, key, pinned)
+		case HostKeyStrict:
+			if known == nil {
+				if known, _, err = knownHosts(address); err != nil {
+					return err
+				}
+			}
+			err = verifyKnownHosts(known, address, remote, key)
+		case HostKeyTOFU:
+			err = verifyTOFU(node, address, key)
+		}
+		if err != nil {
+			return err
+		}
+
+		hostKeyMtx.Lock()
+		verifiedHosts[mode+" "+address] = &verifiedKey{Type: key.Type(), Fingerprint: fingerprint, Time: time.Now()}
+		hostKeyMtx.Unlock()
+		return nil
+	}
+	return algorithms, callback, nil
+}
+
+// recentlyVerified returns the key verified for the address with the given mode in the last few minutes
+func recentlyVerified(mode, address string) (verified *verifiedKey) {
+	hostKeyMtx.Lock()
+	defer hostKeyMtx.Unlock()
+
+	if verified = verifiedHosts[mode+" "+address]; verified != nil && time.Since(verified.Time) < verifiedTTL {
+		return verified
+	}
+	return nil
+}
+
+// verifyPinned verifies the key against the node pinned fingerprint or public key
+func verifyPinned(node *tact.Node, address string, key, pinned ssh.PublicKey) (err error) {
+	fingerprint := ssh.FingerprintSHA256(key)
+	want := node.SSHHostKey
+
+	switch {
+	case pinned != nil:
+		if string(pinned.Marshal()) == string(key.Marshal()) {
+			return nil
+		}
+		want = ssh.FingerprintSHA256(pinned)
+	case want == fingerprint, want == ssh.FingerprintLegacyMD5(key):
+		return nil
+	}
+	return &HostKeyError{Address: address, Mode: HostKeyPinned, Fingerprint: fingerprint, Want: []string{want}}
+}
+
+// knownHosts returns the known_hosts file callback and the types of the keys known for the address,
+// so the handshake negotiates a key that can be verified
+func knownHosts(address string) (callback ssh.HostKeyCallback, algorithms []string, err error) {
+	hostKeyMtx.Lock()
+	file := knownHostsFile
+	hostKeyMtx.Unlock()
+	if file == "" {
+		return nil, nil, errNoKnownHosts
+	}
+
+	if callback, err = knownhosts.New(file); err != nil {
+		return nil, nil, fmt.Errorf("ssh: reading known hosts: %s", err)
+	}
+
+	// The probe key matches no known key, so the error lists all keys known for the address
+	if keyErr, ok := callback(address, &net.TCPAddr{}, probeKey{}).(*knownhosts.KeyError); ok {
+		for _, known := range keyErr.Want {
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	return callback, algorithms, nil
+}
+
+// verifyKnownHosts verifies the key with the known_hosts file callback
+func verifyKnownHosts(callback ssh.HostKeyCallback, address string, remote net.Addr, key ssh.PublicKey) (err error) {
+	err = callback(address, remote, key)
+
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if !ok {
+		return err
+	}
+
+	var want []string
+	for _, known := range keyErr.Want {
+		want = append(want, ssh.FingerprintSHA256(known.Key))
+	}
+	return &HostKeyError{Address: address, Mode: HostKeyStrict, Fingerprint: ssh.FingerprintSHA256(key), Want: want}
+}
+
+// verifyTOFU verifies the key against the key stored on first use, storing it if there is none
+func verifyTOFU(node *tact.Node, address string, key ssh.PublicKey) (err error) {
+	stored, added, err := addHostKey(address, key)
+	if err != nil {
+		return err
+	}
+
+	if added {
+		log.Warn("ssh: trusting host key on first use",
+			"node", node.HostName, "address", address, "fingerprint", stored.Fingerprint)
+		return nil
+	}
+
+	if stored.Key == authorizedKey(key) {
+		return nil
+	}
+	return &HostKeyError{
+		Address:     address,
+		Mode:        HostKeyTOFU,
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Want:        []string{stored.Fingerprint},
+	}
+}
+
+// fetchHostKey returns the host key presented by the host in a handshake aborted before authentication
+func fetchHostKey(address string, timeout time.Duration) (key ssh.PublicKey, err error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	config := &ssh.ClientConfig{
+		User: "tact",
+		HostKeyCallback: func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errKeyCaptured
+		},
+	}
+
+	if _, _, _, err = ssh.NewClientConn(conn, address, config); key == nil {
+		return nil, fmt.Errorf("ssh: getting host key from %s: %s", address, err)
+	}
+	return key, nil
+}
+
+// HostKeys returns the host keys trusted on first use
+func HostKeys() (keys []*HostKey, err error) {
+	txn := tact.Store.NewTxn(false)
+	defer txn.Discard()
+
+	entries, err := txn.GetTree(hostKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		key := &HostKey{}
+		if err = json.Unmarshal(entry.Value, key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// AcceptHostKey connects to the given address, host or host:port, and trusts its current host key,
+// replacing any stored key
+func AcceptHostKey(address string, timeout time.Duration) (hostKey *HostKey, err error) {
+	address = normalizeAddress(address)
+
+	key, err := fetchHostKey(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if hostKey, err = storeHostKey(address, key); err != nil {
+		return nil, err
+	}
+
+	hostKeyMtx.Lock()
+	verifiedHosts = map[string]*verifiedKey{}
+	hostKeyMtx.Unlock()
+	return hostKey, nil
+}
+
+// RevokeHostKey removes the stored host key of the given address, host or host:port
+func RevokeHostKey(address string) (err error) {
+	address = normalizeAddress(address)
+
+	txn := tact.Store.NewTxn(true)
+	defer txn.Discard()
+
+	if _, err = txn.Get(append(hostKeyPrefix, address...)); err != nil {
+		return fmt.Errorf("ssh: host key for %s: %s", address, err)
+	}
+	if err = txn.Delete(append(hostKeyPrefix, address...)); err != nil {
+		return err
+	}
+	if err = txn.Commit(); err != nil {
+		return err
+	}
+
+	hostKeyMtx.Lock()
+	verifiedHosts = map[string]*verifiedKey{}
+	hostKeyMtx.Unlock()
+	return nil
+}
+
+func getHostKey(address string) (hostKey *HostKey, err error) {
+	txn := tact.Store.NewTxn(false)
+	defer txn.Discard()
+
+	data, err := txn.Get(append(hostKeyPrefix, address...))
+	if err != nil {
+		return nil, err
+	}
+
+	hostKey = &HostKey{}
+	return hostKey, json.Unmarshal(data, hostKey)
+}
+
+// addHostKey stores the key if the address has none, returning the stored key and whether it was added.
+// Concurrent first uses conflict on commit, so only one key is stored
+func addHostKey(address string, key ssh.PublicKey) (stored *HostKey, added bool, err error) {
+	txn := tact.Store.NewTxn(true)
+	defer txn.Discard()
+
+	data, err := txn.Get(append(hostKeyPrefix, address...))
+	switch err {
+	case nil:
+		stored = &HostKey{}
+		return stored, false, json.Unmarshal(data, stored)
+	case storage.ErrKeyNotFound:
+	default:
+		return nil, false, err
+	}
+
+	stored = newHostKey(address, key)
+	if data, err = json.Marshal(stored); err != nil {
+		return nil, false, err
+	}
+	if err = txn.Set(append(hostKeyPrefix, address...), data); err != nil {
+		return nil, false, err
+	}
+
+	if err = txn.Commit(); err != nil {
+		// Another connection stored a key first
+		if stored, err = getHostKey(address); err != nil {
+			return nil, false, err
+		}
+		return stored, false, nil
+	}
+	return stored, true, nil
+}
+
+func storeHostKey(address string, key ssh.PublicKey) (hostKey *HostKey, err error) {
+	hostKey = newHostKey(address, key)
+	data, err := json.Marshal(hostKey)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := tact.Store.NewTxn(true)
+	defer txn.Discard()
+
+	if err = txn.Set(append(hostKeyPrefix, address...), data); err != nil {
+		return nil, err
+	}
+	return hostKey, txn.Commit()
+}
+
+func newHostKey(address string, key ssh.PublicKey) (hostKey *HostKey) {
+	return &HostKey{
+		Address:     address,
+		Type:        key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Key:         authorizedKey(key),
+		Added:       time.Now(),
+	}
+}
+
+// authorizedKey returns the public key in authorized_keys format
+func authorizedKey(key ssh.PublicKey) (s string) {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// nodeHostKeyMode returns the node verification mode, pinned if the node has a host key.
+// Unknown modes are an error so a misspelled mode never falls back to a weaker one
+func nodeHostKeyMode(node *tact.Node) (mode string, err error) {
+	switch {
+	case node.SSHHostKeyMode != "":
+		mode = node.SSHHostKeyMode
+	case node.SSHHostKey != "":
+		mode = HostKeyPinned
+	default:
+		hostKeyMtx.Lock()
+		mode = hostKeyMode
+		hostKeyMtx.Unlock()
+	}
+
+	if err = validHostKeyMode(mode); err != nil {
+		return "", fmt.Errorf("%s: %s", node.HostName, err)
+	}
+	return mode, nil
+}
+
+// validHostKeyMode checks the given verification mode is known
+func validHostKeyMode(mode string) (err error) {
+	switch mode {
+	case HostKeyTOFU, HostKeyStrict, HostKeyPinned, HostKeyIgnore:
+		return nil
+	}
+	return fmt.Errorf("ssh: invalid host key mode %q", mode)
+}
+
+// hostAddress returns the node ssh address as host:port
+func hostAddress(node *tact.Node) (address string) {
+	port := node.SSHPort
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(node.NetAddr, port)
+}
+
+// normalizeAddress adds the default ssh port to addresses without one
+func normalizeAddress(address string) (normalized string) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, "22")
+	}
+	return address
+}
+
+func defaultKnownHosts() (file string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
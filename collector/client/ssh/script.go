@@ -0,0 +1,302 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brunotm/rexon"
+	"github.com/brunotm/tact"
+	"github.com/pkg/sftp"
+)
+
+const (
+	// DefaultInterpreter is used for scripts without interpreters
+	DefaultInterpreter = "/bin/sh"
+	// scriptDirPrefix is the prefix of the per user remote script directory, completed with the ssh user
+	scriptDirPrefix = "/tmp/.tact-"
+)
+
+// Script is a script shipped to the node over sftp and executed over ssh.
+// Scripts are kept in a private per user directory as <name>-<checksum prefix>, so different
+// scripts with the same name never replace each other, and are only uploaded when missing.
+// Each run executes in a new working directory, exported as TMPDIR, removed afterwards
+type Script struct {
+	Name         string   // Script name, eg. diskinfo.sh
+	Body         []byte   // Script contents
+	Interpreters []string // Candidate interpreters in order of preference, the first found on the node is used, eg. bash, ksh
+	Args         []string // Script arguments
+	Dir          string   // Remote script directory, /tmp/.tact-<ssh user> if empty
+	Cleanup      bool     // Remove the script after the run instead of keeping it for reuse
+	checksum     string
+	once         sync.Once
+}
+
+// NewScript creates a script with the given name, contents and candidate interpreters
+func NewScript(name string, body []byte, interpreters ...string) (script *Script) {
+	return &Script{Name: name, Body: body, Interpreters: interpreters}
+}
+
+// Checksum returns the hex encoded sha256 checksum of the script contents
+func (s *Script) Checksum() (checksum string) {
+	s.once.Do(func() {
+		sum := sha256.Sum256(s.Body)
+		s.checksum = hex.EncodeToString(sum[:])
+	})
+	return s.checksum
+}
+
+// RunScript uploads the script if needed, executes it and parses its output with the provided parser
+func RunScript(ctx *tact.Context, script *Script, rex rexon.DataParser) (events <-chan []byte) {
+	outCh := make(chan []byte)
+	go runScript(ctx, script, rex, outCh)
+	return outCh
+}
+
+func runScript(ctx *tact.Context, script *Script, rex rexon.DataParser, outCh chan<- []byte) {
+	defer close(outCh)
+
+	dir := script.Dir
+	if dir == "" {
+		dir = scriptDirPrefix + ctx.Node().SSHUser
+	}
+	scriptPath := path.Join(dir, script.Name+"-"+script.Checksum()[:12])
+
+	sftpClient, err := SFTPClient(ctx)
+	if err != nil {
+		ctx.LogError("script: error getting sftp client", "error", err.Error())
+		return
+	}
+	defer sftpClient.Close()
+
+	if err = uploadScript(ctx, sftpClient, dir, scriptPath, script); err != nil {
+		ctx.LogError("script: uploading", "script", scriptPath, "error", err.Error())
+		return
+	}
+
+	workDir, err := makeWorkDir(sftpClient, dir, script.Name)
+	if err != nil {
+		ctx.LogError("script: creating working directory", "script", scriptPath, "error", err.Error())
+		return
+	}
+
+	client, err := Client(ctx)
+	if err != nil {
+		ctx.LogError("script: error getting ssh client", "error", err.Error())
+		return
+	}
+	defer client.Close()
+
+	defer func() {
+		remove := []string{quote(workDir)}
+		if script.Cleanup {
+			remove = append(remove, quote(scriptPath))
+		}
+		if data, err := client.CombinedOutput("rm -rf "+strings.Join(remove, " "), nil); err != nil {
+			ctx.LogWarn("script: cleaning up", "script", scriptPath, "error", err.Error(), "output", string(data))
+		}
+	}()
+
+	interpreter, err := selectInterpreter(client, script.Interpreters)
+	if err != nil {
+		ctx.LogError("script: selecting interpreter", "script", scriptPath, "error", err.Error())
+		return
+	}
+
+	args := make([]string, len(script.Args))
+	for i := range script.Args {
+		args[i] = quote(script.Args[i])
+	}
+
+	cmd := fmt.Sprintf("cd %s && TMPDIR=%s && export TMPDIR && %s %s %s",
+		quote(workDir), quote(workDir), interpreter, quote(scriptPath), strings.Join(args, " "))
+	ctx.LogDebug("script: executing", "command", cmd)
+
+	data, err := client.CombinedReader(cmd, nil)
+	if err != nil {
+		ctx.LogError("script: executing", "script", scriptPath, "error", err.Error())
+		return
+	}
+	defer data.Close()
+
+	for result := range rex.Parse(ctx.Context(), data) {
+		for e := range result.Errors {
+			ctx.LogError(result.Errors[e].Error())
+		}
+
+		if result.Data == nil {
+			continue
+		}
+
+		if !tact.WrapCtxSend(ctx.Context(), outCh, result.Data) {
+			ctx.LogError("script: timed out sending event to upstream processing")
+			return
+		}
+	}
+}
+
+// uploadScript uploads the script to the private script directory unless an identical copy is there
+func uploadScript(ctx *tact.Context, client *SFTPConn, dir, scriptPath string, script *Script) (err error) {
+	if err = privateDir(client, dir); err != nil {
+		return err
+	}
+
+	if remoteChecksum(client, scriptPath, int64(len(script.Body))) == script.Checksum() {
+		ctx.LogDebug("script: reusing uploaded script", "script", scriptPath, "checksum", script.Checksum())
+		return nil
+	}
+
+	// Upload to a temporary file and rename so concurrent runs never see a partial script
+	tmpPath := scriptPath + "." + randomSuffix()
+	file, err := client.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(script.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = client.Chmod(tmpPath, 0700)
+	}
+	if err == nil {
+		if err = client.PosixRename(tmpPath, scriptPath); err != nil {
+			// Servers without the posix-rename extension do not replace existing files
+			client.Remove(scriptPath)
+			err = client.Rename(tmpPath, scriptPath)
+		}
+	}
+	if err != nil {
+		client.Remove(tmpPath)
+		return err
+	}
+
+	// Verify the uploaded contents
+	if sum := remoteChecksum(client, scriptPath, int64(len(script.Body))); sum != script.Checksum() {
+		return fmt.Errorf("checksum mismatch after upload: %s != %s", sum, script.Checksum())
+	}
+	ctx.LogDebug("script: uploaded", "script", scriptPath, "checksum", script.Checksum())
+	return nil
+}
+
+// privateDir creates the directory if needed and ensures it is a directory owned by and only accessible by the ssh user
+func privateDir(client *SFTPConn, dir string) (err error) {
+	info, err := client.Lstat(dir)
+	if err != nil {
+		if err = client.Mkdir(dir); err != nil {
+			return err
+		}
+		if info, err = client.Lstat(dir); err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		return fmt.Errorf("%s: unknown owner", dir)
+	}
+	uid, err := remoteUID(client)
+	if err != nil {
+		return err
+	}
+	if stat.UID != uid {
+		return fmt.Errorf("%s is owned by uid %d, not by the ssh user uid %d", dir, stat.UID, uid)
+	}
+
+	if info.Mode().Perm() != 0700 {
+		return client.Chmod(dir, os.ModeDir|0700)
+	}
+	return nil
+}
+
+// remoteUID returns the uid of the ssh user
+func remoteUID(client *SFTPConn) (uid uint32, err error) {
+	data, err := client.conn.CombinedOutput("id -u", nil)
+	if err != nil {
+		return 0, fmt.Errorf("getting the ssh user uid: %s", err)
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("getting the ssh user uid: %s", err)
+	}
+	return uint32(id), nil
+}
+
+// remoteChecksum returns the hex encoded sha256 checksum of the remote file,
+// empty if it does not exist, can not be read or its size differs from the given one
+func remoteChecksum(client *SFTPConn, filePath string, size int64) (checksum string) {
+	info, err := client.Lstat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return ""
+	}
+
+	file, err := client.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// makeWorkDir creates a new working directory for a script run
+func makeWorkDir(client *SFTPConn, dir, name string) (workDir string, err error) {
+	workDir = path.Join(dir, name+".run."+randomSuffix())
+	if err = client.Mkdir(workDir); err != nil {
+		return "", err
+	}
+	return workDir, nil
+}
+
+// selectInterpreter returns the path of the first of the candidate interpreters found on the node
+func selectInterpreter(client *Conn, interpreters []string) (interpreter string, err error) {
+	switch len(interpreters) {
+	case 0:
+		return DefaultInterpreter, nil
+	case 1:
+		return quote(interpreters[0]), nil
+	}
+
+	probes := make([]string, len(interpreters))
+	for i := range interpreters {
+		probes[i] = "command -v " + quote(interpreters[i])
+	}
+
+	data, err := client.CombinedOutput(strings.Join(probes, " || "), nil)
+	if err != nil {
+		return "", fmt.Errorf("none of %s found", strings.Join(interpreters, ", "))
+	}
+
+	// command -v prints the interpreter path
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return quote(strings.TrimSpace(lines[len(lines)-1])), nil
+}
+
+// quote single quotes the given string for the remote shell
+func quote(s string) (quoted string) {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// randomSuffix returns a random hex string for unique remote file names
+func randomSuffix() (suffix string) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
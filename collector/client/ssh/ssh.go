@@ -1,21 +1,37 @@
 package ssh
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/brunotm/rexon"
-	"github.com/brunotm/sshmgr"
-	"github.com/brunotm/sshmgr/manager"
 	"github.com/brunotm/tact"
+	"github.com/pkg/sftp"
 )
 
 const (
 	buffered = false
 )
 
-// Client creates a new ssh client
-func Client(ctx *tact.Context) (client *sshmgr.Client, err error) {
-	return manager.SSHClient(NewSSHNodeConfig(ctx))
+// Client returns a shared ssh connection to the node, verifying the node host key in the connection handshake
+func Client(ctx *tact.Context) (client *Conn, err error) {
+	return connect(ctx.Node(), ctx.Timeout())
+}
+
+// SFTPClient creates a sftp session over a shared ssh connection to the node
+func SFTPClient(ctx *tact.Context) (client *SFTPConn, err error) {
+	conn, err := connect(ctx.Node(), ctx.Timeout())
+	if err != nil {
+		return nil, err
+	}
+
+	sftpClient, err := sftp.NewClient(conn.client)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &SFTPConn{Client: sftpClient, conn: conn}, nil
 }
 
 // Regex executes the given command and parses with the provided parser
@@ -28,7 +44,7 @@ func Regex(ctx *tact.Context, cmd string, rex rexon.DataParser) (events <-chan [
 func regex(ctx *tact.Context, cmd string, rex rexon.DataParser, outCh chan<- []byte) {
 	defer close(outCh)
 
-	client, err := manager.SSHClient(NewSSHNodeConfig(ctx))
+	client, err := Client(ctx)
 	if err != nil {
 		ctx.LogError("sshrex: error getting ssh client: %s", err.Error())
 		return
@@ -78,16 +94,43 @@ func regex(ctx *tact.Context, cmd string, rex rexon.DataParser, outCh chan<- []b
 	}
 }
 
-// NewSSHNodeConfig creates a SSHConfig from a NodeConfig
-func NewSSHNodeConfig(ctx *tact.Context) (config sshmgr.ClientConfig) {
-	node := ctx.Node()
-	config.NetAddr = node.NetAddr
-	config.Port = node.SSHPort
-	config.User = node.SSHUser
-	config.Password = node.SSHPassword
-	config.Key = node.SSHKey
-	config.IgnoreHostKey = true
-	config.ConnDeadline = ctx.Timeout()
-	config.DialTimeout = time.Second * 5
-	return config
+// Discover detects the node type and OS version running uname over ssh, and oslevel on AIX,
+// and sets them in the node
+func Discover(node *tact.Node, timeout time.Duration) (err error) {
+	client, err := connect(node, timeout)
+	if err != nil {
+		return fmt.Errorf("discover %s: %s", node.HostName, err)
+	}
+	defer client.Close()
+
+	data, err := client.CombinedOutput("uname -sr", nil)
+	if err != nil {
+		return fmt.Errorf("discover %s: executing uname: %s", node.HostName, err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("discover %s: empty uname output", node.HostName)
+	}
+
+	nodeType := strings.ToLower(fields[0])
+	var version string
+
+	switch nodeType {
+	case tact.PlatformAIX:
+		// uname -r on AIX reports only the release number
+		if data, err = client.CombinedOutput("oslevel -s", nil); err != nil {
+			return fmt.Errorf("discover %s: executing oslevel: %s", node.HostName, err)
+		}
+		version = strings.TrimSpace(string(data))
+
+	default:
+		if len(fields) > 1 {
+			version = fields[1]
+		}
+	}
+
+	node.Type = nodeType
+	node.OSVersion = version
+	return nil
 }
@@ -2,13 +2,17 @@ package keys
 
 const (
 	// General
-	Time        = "time"
-	LastRunTime = "last_run_time"
-	Delta       = "delta"
-	Metric      = "_metric"
-	Host        = "host"
-	Node        = "node"
-	Collector   = "collector"
+	Time         = "time"
+	LastRunTime  = "last_run_time"
+	Delta        = "delta"
+	Metric       = "_metric"
+	Host         = "host"
+	Node         = "node"
+	Collector    = "collector"
+	Errors       = "_errors"
+	CounterReset = "_counter_reset"
+	CounterWrap  = "_counter_wrap"
+	JoinMissing  = "_join_missing"
 
 	// System general
 	Maj         = "maj"
@@ -21,6 +25,7 @@ const (
 	ArrayID     = "array_id"
 	ArrayDevice = "array_device"
 	MountPoint  = "mount_point"
+	ASMDevice   = "asm_device"
 
 	// LVM
 	VGName = "vg_name"
@@ -76,7 +81,10 @@ const (
 	IOWriteRateAvg      = "io_rate_write_avg"
 	IORateMBAvg         = "io_rate_mb_avg"
 	IORateReadMBAvg     = "io_rate_read_mb_avg"
-	IORateWriteMBAvg    = "io_rate_read_mb_avg"
+	IORateWriteMBAvg    = "io_rate_write_mb_avg"
+	IOReadsMergedAvg    = "avg_reads_merged"
+	IOWritesMergedAvg   = "avg_writes_merged"
+	IOInFlight          = "in_flight_ios"
 	IOWaitMSAvg         = "io_wait_ms_avg"
 	IOWaitReadMSAvg     = "io_wait_read_ms_avg"
 	IOWaitWriteMSAvg    = "io_wait_write_ms_avg"
@@ -3,8 +3,6 @@ package linux
 import (
 	"time"
 
-	"github.com/brunotm/tact/js"
-
 	"github.com/brunotm/rexon"
 	"github.com/brunotm/tact"
 	"github.com/brunotm/tact/collector/client/ssh"
@@ -16,16 +14,81 @@ func init() {
 }
 
 var ioStat = &tact.Collector{
-	Name:    "/linux/performance/iostat",
-	GetData: ioStatFn,
-	PostOps: ioStatPostOps,
+	Name:        "/linux/performance/iostat",
+	Description: "Block device IO rates, throughput and latencies from /proc/diskstats",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Tags:        []string{"storage"},
+	GetData:     ioStatFn,
 	EventOps: &tact.EventOps{
 		Round: 2,
+		Units: map[string]tact.Unit{
+			keys.IORateReadMBAvg:     tact.Sectors,
+			keys.IORateWriteMBAvg:    tact.Sectors,
+			keys.IOLatencyReadMSAvg:  tact.Milliseconds,
+			keys.IOLatencyWriteMSAvg: tact.Milliseconds,
+			keys.IOServiceMSAvg:      tact.Milliseconds,
+			keys.IOWaitMSAvg:         tact.Milliseconds,
+		},
 		Delta: &tact.DeltaOps{
-			KeyField:  "device",
-			TTL:       15 * time.Minute,
-			Rate:      true,
-			Blacklist: tact.BuildBlackList(keys.Device, keys.Maj, keys.Min, "in_flight_ios"),
+			KeyField:      "device",
+			TTL:           15 * time.Minute,
+			Rate:          true,
+			NegativeReset: true,
+			Fields: map[string]tact.DeltaMode{
+				keys.IOInFlight: tact.DeltaGauge,
+			},
+		},
+		Derived: []*tact.Derived{
+			{Field: keys.MajMin, Expression: `maj + ":" + min`},
+			{Field: keys.IORateAvg, Expression: "io_rate_read_mb_avg + io_rate_write_mb_avg"},
+			{Field: keys.IOLatencyMSAvg, Expression: "io_wait_ms_avg"},
+			{Field: keys.IOWaitMSAvg, Expression: "io_wait_ms_avg - io_service_ms_avg"},
+		},
+		FieldDeletes: []string{keys.Maj, keys.Min},
+		Aggregates: []*tact.Aggregate{
+			{
+				Name: "total",
+				// Whole disks only, partitions and dm and md devices would count their IO twice
+				Where: &tact.Filter{
+					Include: []*tact.Predicate{
+						{Field: keys.Device, Op: tact.OpRegex, Value: `^((s|v|xv|h)d[a-z]+|nvme[0-9]+n[0-9]+|mmcblk[0-9]+)$`},
+					},
+				},
+				Fields: map[string][]string{
+					keys.IOReadRateAvg:    {tact.AggSum},
+					keys.IOWriteRateAvg:   {tact.AggSum},
+					keys.IORateReadMBAvg:  {tact.AggSum},
+					keys.IORateWriteMBAvg: {tact.AggSum},
+					keys.IORateAvg:        {tact.AggSum},
+					keys.IOInFlight:       {tact.AggSum, tact.AggMax},
+				},
+			},
+		},
+	},
+	Filter: &tact.Filter{
+		Exclude: []*tact.Predicate{
+			{Field: keys.Device, Op: tact.OpGlob, Value: "loop*"},
+			{Field: keys.Device, Op: tact.OpGlob, Value: "ram*"},
+		},
+	},
+	Schema: &tact.Schema{
+		Fields: []*tact.Field{
+			{Name: keys.Device, Type: tact.FieldString, Required: true, Description: "Block device name"},
+			{Name: keys.MajMin, Type: tact.FieldString, Required: true, Description: "Device major:minor numbers"},
+			{Name: keys.IOReadRateAvg, Type: tact.FieldNumber, Unit: "ops/s", Description: "Reads completed"},
+			{Name: keys.IOReadsMergedAvg, Type: tact.FieldNumber, Unit: "ops/s", Description: "Adjacent reads merged"},
+			{Name: keys.IORateReadMBAvg, Type: tact.FieldNumber, Description: "Data read"},
+			{Name: keys.IOLatencyReadMSAvg, Type: tact.FieldNumber, Description: "Time spent reading"},
+			{Name: keys.IOWriteRateAvg, Type: tact.FieldNumber, Unit: "ops/s", Description: "Writes completed"},
+			{Name: keys.IOWritesMergedAvg, Type: tact.FieldNumber, Unit: "ops/s", Description: "Adjacent writes merged"},
+			{Name: keys.IORateWriteMBAvg, Type: tact.FieldNumber, Description: "Data written"},
+			{Name: keys.IOLatencyWriteMSAvg, Type: tact.FieldNumber, Description: "Time spent writing"},
+			{Name: keys.IOInFlight, Type: tact.FieldNumber, Description: "IOs currently in progress"},
+			{Name: keys.IOServiceMSAvg, Type: tact.FieldNumber, Description: "Time spent doing IOs"},
+			{Name: keys.IOWaitMSAvg, Type: tact.FieldNumber, Description: "Time spent queued"},
+			{Name: keys.IOLatencyMSAvg, Type: tact.FieldNumber, Unit: "ms/s", Description: "Weighted time spent doing IOs"},
+			{Name: keys.IORateAvg, Type: tact.FieldNumber, Unit: "MB/s", Description: "Data read and written"},
 		},
 	},
 	Joins: []*tact.Join{
@@ -56,7 +119,7 @@ var ioStat = &tact.Collector{
 			IncludeFields: []string{
 				keys.ArrayID, keys.ArrayDevice,
 				keys.DeviceWWN, keys.SizeMB, keys.VGName,
-				keys.VGType, keys.VGMode, "asm_device"},
+				keys.VGType, keys.VGMode, keys.ASMDevice},
 		},
 	},
 }
@@ -67,14 +130,14 @@ var ioStatParser = rexon.MustNewParser(
 		rexon.MustNewValue(keys.Min, rexon.String),
 		rexon.MustNewValue(keys.Device, rexon.String),
 		rexon.MustNewValue(keys.IOReadRateAvg, rexon.Number),
-		rexon.MustNewValue("avg_reads_merged", rexon.Number),
+		rexon.MustNewValue(keys.IOReadsMergedAvg, rexon.Number),
 		rexon.MustNewValue(keys.IORateReadMBAvg, rexon.Number),
 		rexon.MustNewValue(keys.IOLatencyReadMSAvg, rexon.Number),
 		rexon.MustNewValue(keys.IOWriteRateAvg, rexon.Number),
-		rexon.MustNewValue("avg_writes_merged", rexon.Number),
+		rexon.MustNewValue(keys.IOWritesMergedAvg, rexon.Number),
 		rexon.MustNewValue(keys.IORateWriteMBAvg, rexon.Number),
 		rexon.MustNewValue(keys.IOLatencyWriteMSAvg, rexon.Number),
-		rexon.MustNewValue("in_flight_ios", rexon.Number),
+		rexon.MustNewValue(keys.IOInFlight, rexon.Number),
 		rexon.MustNewValue(keys.IOServiceMSAvg, rexon.Number),
 		rexon.MustNewValue(keys.IOWaitMSAvg, rexon.Number),
 	},
@@ -84,32 +147,3 @@ var ioStatParser = rexon.MustNewParser(
 func ioStatFn(ctx *tact.Context) (events <-chan []byte) {
 	return ssh.Regex(ctx, "cat /proc/diskstats", ioStatParser)
 }
-
-func ioStatPostOps(event []byte) (out []byte, err error) {
-
-	// calculate avg_io_rate
-	reads, err := js.GetFloat(event, keys.IORateReadMBAvg)
-	writes, err := js.GetFloat(event, keys.IORateWriteMBAvg)
-	event, err = js.Set(event, reads+writes, keys.IORateAvg)
-
-	// maj:min
-	maj, err := js.GetUnsafeString(event, keys.Maj)
-	min, err := js.GetUnsafeString(event, keys.Min)
-	event, err = js.Set(event, maj+":"+min, keys.MajMin)
-	event = js.Delete(event, keys.Maj)
-	event = js.Delete(event, keys.Min)
-
-	// avg_read/write_kb
-	readSect, err := js.GetFloat(event, keys.IORateReadMBAvg)
-	event, err = js.Set(event, (readSect*512)/1000, keys.IORateReadMBAvg)
-	writeSect, err := js.GetFloat(event, keys.IORateWriteMBAvg)
-	event, err = js.Set(event, (writeSect*512)/1000, keys.IORateWriteMBAvg)
-
-	// avg_wait_ms and avg_svctm_total_ms
-	svctm, err := js.GetFloat(event, keys.IOServiceMSAvg)
-	wait, err := js.GetFloat(event, keys.IOWaitMSAvg)
-	event, err = js.Set(event, wait-svctm, keys.IOWaitMSAvg)
-	event, err = js.Set(event, wait, keys.IOLatencyMSAvg)
-
-	return event, err
-}
@@ -1,20 +1,16 @@
 package linux
 
 import (
-	"fmt"
-	"time"
-
 	"github.com/brunotm/tact/collector/keys"
 
 	"github.com/brunotm/rexon"
 	"github.com/brunotm/tact"
 	"github.com/brunotm/tact/collector/client/sftp"
-	"github.com/brunotm/tact/js"
 )
 
 const (
 	fileName   = "messages"
-	timeLayout = "Jan 2 15:04:05 2006"
+	timeLayout = "Jan 2 15:04:05"
 )
 
 func init() {
@@ -22,9 +18,14 @@ func init() {
 }
 
 var logMessages = &tact.Collector{
-	Name:    "/linux/log/messages",
-	GetData: logMessagesFn,
-	PostOps: logMessagesPostOps,
+	Name:        "/linux/log/messages",
+	Description: "System log messages from the messages log file",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     logMessagesFn,
+	PostOps: []*tact.PostOp{
+		{Name: "timestamp", Fn: tact.ParseTime(keys.Time, timeLayout)},
+	},
 }
 
 var logMessagesParser = rexon.MustNewParser(
@@ -39,13 +40,3 @@ var logMessagesParser = rexon.MustNewParser(
 func logMessagesFn(ctx *tact.Context) (events <-chan []byte) {
 	return sftp.Regex(ctx, fileName, logMessagesParser)
 }
-
-func logMessagesPostOps(event []byte) (out []byte, err error) {
-	ts, _ := js.GetUnsafeString(event, keys.Time)
-	timestamp, err := time.Parse(timeLayout, fmt.Sprintf("%s %d", ts, time.Now().Year()))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse timestamp: %s, error: %s", ts, err.Error())
-	}
-	event, err = js.Set(event, timestamp, keys.Time)
-	return event, err
-}
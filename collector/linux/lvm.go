@@ -8,7 +8,6 @@ import (
 	"github.com/brunotm/rexon"
 	"github.com/brunotm/tact"
 	"github.com/brunotm/tact/collector/client/ssh"
-	"github.com/brunotm/tact/js"
 )
 
 func init() {
@@ -18,8 +17,22 @@ func init() {
 }
 
 var lsblk = &tact.Collector{
-	Name:    "/linux/config/lsblk",
-	GetData: lsblkFn,
+	Name:        "/linux/config/lsblk",
+	Description: "Block devices and their device mapper relations from lsblk",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Schedule:    "0 0 */1 * * *",
+	Tags:        []string{"storage"},
+	GetData:     lsblkFn,
+	Schema: &tact.Schema{
+		Fields: []*tact.Field{
+			{Name: keys.Device, Type: tact.FieldString, Required: true, Description: "Block device name"},
+			{Name: keys.DeviceDM, Type: tact.FieldString, Description: "Device mapper name"},
+			{Name: keys.MajMin, Type: tact.FieldString, Required: true, Description: "Device major:minor numbers"},
+			{Name: keys.SizeMB, Type: tact.FieldNumber, Unit: "MB", Description: "Device size"},
+			{Name: keys.MountPoint, Type: tact.FieldString, Description: "Device mount point"},
+		},
+	},
 	Joins: []*tact.Join{
 		{
 			TTL:           3 * time.Hour,
@@ -47,8 +60,20 @@ func lsblkFn(ctx *tact.Context) (events <-chan []byte) {
 }
 
 var pvs = &tact.Collector{
-	Name:    "/linux/config/pvs",
-	GetData: pvsFn,
+	Name:        "/linux/config/pvs",
+	Description: "LVM physical volumes and volume groups from pvs",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Schedule:    "0 0 */1 * * *",
+	Tags:        []string{"storage"},
+	GetData:     pvsFn,
+	Schema: &tact.Schema{
+		Fields: []*tact.Field{
+			{Name: keys.Device, Type: tact.FieldString, Required: true, Description: "Physical volume device name"},
+			{Name: keys.VGName, Type: tact.FieldString, Description: "Volume group name"},
+			{Name: keys.VGType, Type: tact.FieldString, Description: "Volume group format"},
+		},
+	},
 	Joins: []*tact.Join{
 		{
 			TTL:           3 * time.Hour,
@@ -74,9 +99,31 @@ func pvsFn(ctx *tact.Context) (events <-chan []byte) {
 }
 
 var asmDevices = &tact.Collector{
-	Name:    "/linux/config/asm",
-	GetData: asmDevicesFn,
-	PostOps: asmDevicesPostOpsFn,
+	Name:        "/linux/config/asm",
+	Description: "Oracle ASMLib disks from /dev/oracleasm/disks",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Schedule:    "0 0 */1 * * *",
+	Tags:        []string{"storage"},
+	GetData:     asmDevicesFn,
+	EventOps: &tact.EventOps{
+		Derived: []*tact.Derived{
+			{Field: keys.MajMin, Expression: `maj + ":" + min`},
+			{Field: keys.VGType, Expression: `"oracleasm"`},
+			{Field: keys.VGName, Expression: "null"},
+			{Field: keys.VGMode, Expression: "null"},
+		},
+		FieldDeletes: []string{keys.Maj, keys.Min},
+	},
+	Schema: &tact.Schema{
+		Fields: []*tact.Field{
+			{Name: keys.ASMDevice, Type: tact.FieldString, Required: true, Description: "Oracle ASM disk name"},
+			{Name: keys.MajMin, Type: tact.FieldString, Required: true, Description: "Device major:minor numbers"},
+			{Name: keys.VGType, Type: tact.FieldString, Description: "Volume manager type"},
+			{Name: keys.VGName, Type: tact.FieldString, Description: "Volume group name"},
+			{Name: keys.VGMode, Type: tact.FieldString, Description: "Volume group mode"},
+		},
+	},
 	Joins: []*tact.Join{
 		{
 			TTL:           3 * time.Hour,
@@ -92,7 +139,7 @@ var asmDevicesParser = rexon.MustNewParser(
 	[]*rexon.Value{
 		rexon.MustNewValue(keys.Maj, rexon.String),
 		rexon.MustNewValue(keys.Min, rexon.String),
-		rexon.MustNewValue("asm_device", rexon.String),
+		rexon.MustNewValue(keys.ASMDevice, rexon.String),
 	},
 	rexon.LineRegex(`.*?\s+.*?\s+.*?\s+.*?(\d+),\s+(\d+)\s+.*?\s+.*?\s+.*?\s+.*?(.*)`),
 )
@@ -100,14 +147,3 @@ var asmDevicesParser = rexon.MustNewParser(
 func asmDevicesFn(ctx *tact.Context) (events <-chan []byte) {
 	return ssh.Regex(ctx, "ls -l /dev/oracleasm/disks", asmDevicesParser)
 }
-
-func asmDevicesPostOpsFn(event []byte) (out []byte, err error) {
-	major, _ := js.GetString(event, keys.Maj)
-	minor, _ := js.GetString(event, keys.Min)
-	event = js.Delete(event, keys.Maj)
-	event = js.Delete(event, keys.Min)
-	event, _ = js.Set(event, "oracleasm", keys.VGType)
-	event, _ = js.Set(event, nil, keys.VGName)
-	event, _ = js.Set(event, nil, keys.VGMode)
-	return js.Set(event, major+":"+minor, keys.MajMin)
-}
@@ -8,7 +8,6 @@ import (
 	"github.com/brunotm/rexon"
 	"github.com/brunotm/tact"
 	"github.com/brunotm/tact/collector/client/ssh"
-	"github.com/brunotm/tact/js"
 )
 
 func init() {
@@ -16,15 +15,51 @@ func init() {
 }
 
 var netIOStat = &tact.Collector{
-	Name:    "/linux/performance/netiostat",
-	GetData: netIOStatFn,
-	PostOps: netIOStatPostOpsFn,
+	Name:        "/linux/performance/netiostat",
+	Description: "Network interface throughput, errors and drops from /proc/net/dev",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Tags:        []string{"network"},
+	GetData:     netIOStatFn,
+	Filter: &tact.Filter{
+		Exclude: []*tact.Predicate{
+			{Field: keys.Device, Op: tact.OpEq, Value: "lo"},
+		},
+	},
+	Schema: &tact.Schema{
+		Fields: []*tact.Field{
+			{Name: keys.Device, Type: tact.FieldString, Required: true, Description: "Network interface name"},
+			{Name: keys.NetMBRXAvg, Type: tact.FieldNumber, Description: "Data received"},
+			{Name: keys.NetPacketsRXAvg, Type: tact.FieldNumber, Unit: "packets/s", Description: "Packets received"},
+			{Name: keys.NetErrorsRXAvg, Type: tact.FieldNumber, Unit: "errors/s", Description: "Receive errors"},
+			{Name: keys.NetDropsRXAvg, Type: tact.FieldNumber, Unit: "packets/s", Description: "Received packets dropped"},
+			{Name: keys.NetMBTXAvg, Type: tact.FieldNumber, Description: "Data transmitted"},
+			{Name: keys.NetPacketsTXAvg, Type: tact.FieldNumber, Unit: "packets/s", Description: "Packets transmitted"},
+			{Name: keys.NetErrorsTXAvg, Type: tact.FieldNumber, Unit: "errors/s", Description: "Transmit errors"},
+			{Name: keys.NetDropsTXAvg, Type: tact.FieldNumber, Unit: "packets/s", Description: "Transmitted packets dropped"},
+			{Name: keys.NetPacketsAvg, Type: tact.FieldNumber, Unit: "packets/s", Description: "Packets received and transmitted"},
+			{Name: keys.NetMBAvg, Type: tact.FieldNumber, Unit: "MB/s", Description: "Data received and transmitted"},
+			{Name: keys.NetErrorsAvg, Type: tact.FieldNumber, Unit: "errors/s", Description: "Receive and transmit errors"},
+			{Name: keys.NetDropsAvg, Type: tact.FieldNumber, Unit: "packets/s", Description: "Packets dropped"},
+		},
+	},
 	EventOps: &tact.EventOps{
+		Units: map[string]tact.Unit{
+			keys.NetMBRXAvg: tact.Bytes,
+			keys.NetMBTXAvg: tact.Bytes,
+		},
 		Delta: &tact.DeltaOps{
-			KeyField:  keys.Device,
-			TTL:       15 * time.Minute,
-			Rate:      true,
-			Blacklist: tact.BuildBlackList(keys.Device),
+			KeyField:      keys.Device,
+			TTL:           15 * time.Minute,
+			Rate:          true,
+			CounterBits:   32, // /proc/net/dev counters are 32 bit on 32 bit kernels
+			NegativeReset: true,
+		},
+		Derived: []*tact.Derived{
+			{Field: keys.NetPacketsAvg, Expression: "net_packets_rx_avg + net_packets_tx_avg"},
+			{Field: keys.NetMBAvg, Expression: "net_mb_rx_avg + net_mb_tx_avg"},
+			{Field: keys.NetErrorsAvg, Expression: "net_errors_rx_avg + net_errors_tx_avg"},
+			{Field: keys.NetDropsAvg, Expression: "net_drops_rx_avg + net_drops_tx_avg"},
 		},
 	},
 }
@@ -32,11 +67,11 @@ var netIOStat = &tact.Collector{
 var netIOStatParser = rexon.MustNewParser(
 	[]*rexon.Value{
 		rexon.MustNewValue(keys.Device, rexon.String),
-		rexon.MustNewValue(keys.NetMBRXAvg, rexon.DigitalUnit, rexon.ToFormat("mb")),
+		rexon.MustNewValue(keys.NetMBRXAvg, rexon.Number),
 		rexon.MustNewValue(keys.NetPacketsRXAvg, rexon.Number),
 		rexon.MustNewValue(keys.NetErrorsRXAvg, rexon.Number),
 		rexon.MustNewValue(keys.NetDropsRXAvg, rexon.Number),
-		rexon.MustNewValue(keys.NetMBTXAvg, rexon.DigitalUnit, rexon.ToFormat("mb")),
+		rexon.MustNewValue(keys.NetMBTXAvg, rexon.Number),
 		rexon.MustNewValue(keys.NetPacketsTXAvg, rexon.Number),
 		rexon.MustNewValue(keys.NetErrorsTXAvg, rexon.Number),
 		rexon.MustNewValue(keys.NetDropsTXAvg, rexon.Number),
@@ -48,20 +83,3 @@ var netIOStatParser = rexon.MustNewParser(
 func netIOStatFn(ctx *tact.Context) (events <-chan []byte) {
 	return ssh.Regex(ctx, "cat /proc/net/dev", netIOStatParser)
 }
-
-func netIOStatPostOpsFn(event []byte) (out []byte, err error) {
-	// Add total averages for each rx/tx measurement
-	pktRX, _ := js.GetFloat(event, keys.NetPacketsRXAvg)
-	pktTX, _ := js.GetFloat(event, keys.NetPacketsTXAvg)
-	event, _ = js.Set(event, pktRX+pktTX, keys.NetPacketsAvg)
-	mbRX, _ := js.GetFloat(event, keys.NetMBRXAvg)
-	mbTX, _ := js.GetFloat(event, keys.NetMBTXAvg)
-	event, _ = js.Set(event, mbRX+mbTX, keys.NetMBAvg)
-	errorsRX, _ := js.GetFloat(event, keys.NetErrorsRXAvg)
-	errorsTX, _ := js.GetFloat(event, keys.NetErrorsTXAvg)
-	event, _ = js.Set(event, errorsRX+errorsTX, keys.NetErrorsAvg)
-	dropsRX, _ := js.GetFloat(event, keys.NetDropsRXAvg)
-	dropsTX, _ := js.GetFloat(event, keys.NetDropsTXAvg)
-	event, _ = js.Set(event, dropsRX+dropsTX, keys.NetDropsAvg)
-	return event, nil
-}
@@ -15,6 +15,11 @@ const (
 )
 
 var storage = &tact.Collector{
-	Name:    "/linux/config/storage",
-	GetData: common.NewUnixEMCStorageFn(inqPath, inqRex),
+	Name:        "/linux/config/storage",
+	Description: "Storage array devices from EMC inq",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	Schedule:    "0 0 */1 * * *",
+	Tags:        []string{"storage"},
+	GetData:     common.NewUnixEMCStorageFn(inqPath, inqRex),
 }
@@ -7,7 +7,10 @@ import (
 
 func init() {
 	tact.Registry.Add(&tact.Collector{
-		Name:    "/linux/performance/uptime",
-		GetData: common.NewUnixUptimeFn(),
+		Name:        "/linux/performance/uptime",
+		Description: "System uptime and load averages",
+		Platforms:   []string{tact.PlatformLinux},
+		Credentials: []tact.Credential{tact.CredentialSSH},
+		GetData:     common.NewUnixUptimeFn(),
 	})
 }
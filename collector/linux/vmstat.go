@@ -20,31 +20,35 @@ func init() {
 }
 
 var vmStat = &tact.Collector{
-	Name:    "/linux/performance/vmstat",
-	GetData: vmStatFn,
-	PostOps: vmStatPostOps,
+	Name:        "/linux/performance/vmstat",
+	Description: "Memory, swap, paging and CPU utilization from vmstat",
+	Platforms:   []string{tact.PlatformLinux},
+	Credentials: []tact.Credential{tact.CredentialSSH},
+	GetData:     vmStatFn,
+	PostOps:     []*tact.PostOp{{Name: "cpu_pct", Fn: vmStatPostOps}},
 	EventOps: &tact.EventOps{
 		Round: 2,
 		Delta: &tact.DeltaOps{
-			TTL:  15 * time.Minute,
-			Rate: true,
-			Blacklist: tact.BuildBlackList(
-				keys.MemTotalMB,
-				keys.MemUsedMB,
-				keys.MemActiveMB,
-				keys.MemInactiveMB,
-				keys.MemFreeMB,
-				keys.MemBufferMB,
-				keys.SwapCacheMB,
-				keys.SwapTotalMB,
-				keys.SwapUsedMB,
-				keys.SwapFreeMB),
-			RateBlacklist: tact.BuildBlackList(
-				"cpu_user_ticks",
-				"cpu_usernice_ticks",
-				"cpu_system_ticks",
-				"cpu_idle_ticks",
-				"cpu_wait_ticks"),
+			TTL:           15 * time.Minute,
+			Rate:          true,
+			NegativeReset: true,
+			Fields: map[string]tact.DeltaMode{
+				keys.MemTotalMB:      tact.DeltaGauge,
+				keys.MemUsedMB:       tact.DeltaGauge,
+				keys.MemActiveMB:     tact.DeltaGauge,
+				keys.MemInactiveMB:   tact.DeltaGauge,
+				keys.MemFreeMB:       tact.DeltaGauge,
+				keys.MemBufferMB:     tact.DeltaGauge,
+				keys.SwapCacheMB:     tact.DeltaGauge,
+				keys.SwapTotalMB:     tact.DeltaGauge,
+				keys.SwapUsedMB:      tact.DeltaGauge,
+				keys.SwapFreeMB:      tact.DeltaGauge,
+				"cpu_user_ticks":     tact.DeltaCounter,
+				"cpu_usernice_ticks": tact.DeltaCounter,
+				"cpu_system_ticks":   tact.DeltaCounter,
+				"cpu_idle_ticks":     tact.DeltaCounter,
+				"cpu_wait_ticks":     tact.DeltaCounter,
+			},
 		},
 	},
 }
@@ -15,8 +15,11 @@ func init() {
 }
 
 var asmDiskGroup = &tact.Collector{
-	Name:    "/oracle/config/asm_diskgroup",
-	GetData: asmDiskGroupFn,
+	Name:        "/oracle/config/asm_diskgroup",
+	Description: "ASM diskgroup allocation and usage",
+	Credentials: []tact.Credential{tact.CredentialDB},
+	Schedule:    "0 0 */1 * * *",
+	GetData:     asmDiskGroupFn,
 	EventOps: &tact.EventOps{
 		FieldTypes: []*rexon.Value{
 			rexon.MustNewValue("group_number", rexon.Number),
@@ -16,8 +16,11 @@ func init() {
 }
 
 var datafiles = &tact.Collector{
-	Name:    "/oracle/config/datafiles",
-	GetData: datafilesFn,
+	Name:        "/oracle/config/datafiles",
+	Description: "Datafile allocation and usage",
+	Credentials: []tact.Credential{tact.CredentialDB},
+	Schedule:    "0 0 */1 * * *",
+	GetData:     datafilesFn,
 	EventOps: &tact.EventOps{
 		FieldTypes: []*rexon.Value{
 			rexon.MustNewValue("file_name", rexon.String),
@@ -18,8 +18,10 @@ func init() {
 }
 
 var logAlert = &tact.Collector{
-	Name:    "/oracle/log/alert",
-	GetData: logAlertFn,
+	Name:        "/oracle/log/alert",
+	Description: "Database alert log messages",
+	Credentials: []tact.Credential{tact.CredentialDB},
+	GetData:     logAlertFn,
 }
 
 var logAlertParser = rexon.MustNewParser(
@@ -15,8 +15,10 @@ func init() {
 }
 
 var sessions = &tact.Collector{
-	Name:    "/oracle/performance/sessions",
-	GetData: sessionsFn,
+	Name:        "/oracle/performance/sessions",
+	Description: "Inactive session count",
+	Credentials: []tact.Credential{tact.CredentialDB},
+	GetData:     sessionsFn,
 	EventOps: &tact.EventOps{
 		FieldTypes: []*rexon.Value{
 			rexon.MustNewValue("active_sessions", rexon.Number),
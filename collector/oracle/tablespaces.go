@@ -15,8 +15,11 @@ func init() {
 }
 
 var tableSpaces = &tact.Collector{
-	Name:    "/oracle/config/tablespaces",
-	GetData: tableSpacesFn,
+	Name:        "/oracle/config/tablespaces",
+	Description: "Tablespace allocation and usage",
+	Credentials: []tact.Credential{tact.CredentialDB},
+	Schedule:    "0 0 */1 * * *",
+	GetData:     tableSpacesFn,
 	EventOps: &tact.EventOps{
 		FieldTypes: []*rexon.Value{
 			rexon.MustNewValue("tablespace_name", rexon.String),
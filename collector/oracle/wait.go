@@ -9,8 +9,10 @@ import (
 )
 
 const (
-	waitClassQuery = `select wait_class, total_waits as total_waits_avg,
-	time_waited/10 as time_waited_ms_avg from v$system_wait_class where wait_class != 'Idle'`
+	// The instance number of the session keeps the baselines of RAC instances apart
+	waitClassQuery = `select sys_context('USERENV', 'INSTANCE') as inst_id, wait_class,
+	total_waits as total_waits_avg, time_waited/10 as time_waited_ms_avg, systimestamp as sample_time
+	from v$system_wait_class where wait_class != 'Idle'`
 )
 
 // init register this collector with the dispatcher
@@ -19,11 +21,14 @@ func init() {
 }
 
 var waitClass = &tact.Collector{
-	Name:    "/oracle/performance/waitclass",
-	GetData: waitClassFn,
+	Name:        "/oracle/performance/waitclass",
+	Description: "Wait time and counts by wait class per instance",
+	Credentials: []tact.Credential{tact.CredentialDB},
+	GetData:     waitClassFn,
 	EventOps: &tact.EventOps{
 		Round: 2,
 		FieldTypes: []*rexon.Value{
+			rexon.MustNewValue("inst_id", rexon.String),
 			rexon.MustNewValue("wait_class", rexon.String),
 			rexon.MustNewValue("total_waits_avg", rexon.Number),
 			rexon.MustNewValue("time_waited_ms_avg", rexon.Number),
@@ -31,8 +36,18 @@ var waitClass = &tact.Collector{
 		Delta: &tact.DeltaOps{
 			Rate:      true,
 			TTL:       15 * time.Minute,
-			KeyField:  "wait_class",
-			Blacklist: tact.BuildBlackList("wait_class"),
+			Key:       tact.NewKey("/", "inst_id", "wait_class"),
+			TimeField: "sample_time",
+		},
+		Aggregates: []*tact.Aggregate{
+			{
+				Name:    "total",
+				GroupBy: []string{"inst_id"},
+				Fields: map[string][]string{
+					"total_waits_avg":    {tact.AggSum},
+					"time_waited_ms_avg": {tact.AggSum, tact.AggMax},
+				},
+			},
 		},
 	},
 }
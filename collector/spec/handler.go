@@ -0,0 +1,66 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/brunotm/tact"
+)
+
+// maxSpecSize is the maximum size of a request body with collector specs
+const maxSpecSize = 1 << 20
+
+// Handler returns a http.Handler registering the JSON or YAML collector specs in the body of POST requests.
+// The added function, if not nil, is called with the registered collectors, eg. to schedule them.
+// No collector is registered if any spec is invalid or added fails
+func Handler(added func(collectors []*tact.Collector) (err error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeResponse(w, http.StatusMethodNotAllowed, nil, fmt.Errorf("spec: method %s not allowed", r.Method))
+			return
+		}
+
+		collectors, err := Load(http.MaxBytesReader(w, r.Body, maxSpecSize))
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, nil, err)
+			return
+		}
+
+		names, err := registerAll(collectors)
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, nil, err)
+			return
+		}
+
+		if added != nil {
+			if err = added(collectors); err != nil {
+				if uerr := Unregister(names); uerr != nil {
+					err = fmt.Errorf("%s, %s", err, uerr)
+				}
+				writeResponse(w, http.StatusInternalServerError, nil, err)
+				return
+			}
+		}
+		writeResponse(w, http.StatusCreated, names, nil)
+	})
+}
+
+// response is the handler response body
+type response struct {
+	Collectors []string `json:"collectors,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// writeResponse writes the collector names or error as a JSON response
+func writeResponse(w http.ResponseWriter, status int, names []string, err error) {
+	resp := response{Collectors: names}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,734 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brunotm/rexon"
+	"github.com/brunotm/tact"
+	"github.com/brunotm/tact/collector/client/oracle"
+	"github.com/brunotm/tact/collector/client/process"
+	"github.com/brunotm/tact/collector/client/sftp"
+	"github.com/brunotm/tact/collector/client/ssh"
+	"github.com/ghodss/yaml"
+)
+
+// Spec is the JSON or YAML definition of a collector. Exactly one of Command, Script, File, Query or Exec must be given
+type Spec struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Platforms   []string          `json:"platforms,omitempty"`
+	Credentials []string          `json:"credentials,omitempty"`
+	Schedule    string            `json:"schedule,omitempty"`
+	Timeout     Duration          `json:"timeout,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Command     string            `json:"command,omitempty"`     // Command run over ssh and parsed with Parser
+	Script      string            `json:"script,omitempty"`      // Script uploaded and run over ssh and parsed with Parser
+	Interpreter []string          `json:"interpreter,omitempty"` // Candidate script interpreters, eg. bash, ksh
+	File        string            `json:"file,omitempty"`        // Node log file name read over sftp and parsed with Parser
+	Query       string            `json:"query,omitempty"`       // SQL query run on the node database
+	Exec        []string          `json:"exec,omitempty"`        // Local helper program and arguments streaming events, see package process
+	Parser      *Parser           `json:"parser,omitempty"`
+	Values      []*Value          `json:"values,omitempty"` // Field type conversions, eg. for query columns
+	Round       int               `json:"round,omitempty"`
+	Units       map[string]string `json:"units,omitempty"`
+	Renames     map[string]string `json:"renames,omitempty"`
+	Deletes     []string          `json:"deletes,omitempty"`
+	Delta       *Delta            `json:"delta,omitempty"`
+	Derived     []*Derived        `json:"derived,omitempty"`
+	Aggregates  []*Aggregate      `json:"aggregates,omitempty"`
+	Joins       []*Join           `json:"joins,omitempty"`
+	PostOps     []*PostOp         `json:"post_ops,omitempty"` // Applied in order after the event ops
+	Schema      *Schema           `json:"schema,omitempty"`
+	Filter      *Filter           `json:"filter,omitempty"`
+}
+
+// Parser defines a rexon parser for command, script and file output
+type Parser struct {
+	Values      []*Value `json:"values"`
+	LineRegex   string   `json:"line_regex,omitempty"`
+	FindAll     bool     `json:"find_all,omitempty"`
+	TrimSpaces  bool     `json:"trim_spaces,omitempty"`
+	StartTag    string   `json:"start_tag,omitempty"`
+	StopTag     string   `json:"stop_tag,omitempty"`
+	SkipTag     string   `json:"skip_tag,omitempty"`
+	ContinueTag string   `json:"continue_tag,omitempty"`
+}
+
+// Value defines a rexon value
+type Value struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"` // number, string, bool, time, duration or digital_unit
+	Regex      string `json:"regex,omitempty"`
+	Round      int    `json:"round,omitempty"`
+	FromFormat string `json:"from_format,omitempty"`
+	ToFormat   string `json:"to_format,omitempty"`
+	Nullable   bool   `json:"nullable,omitempty"`
+}
+
+// Delta defines the delta calculations
+type Delta struct {
+	KeyField      string            `json:"key_field,omitempty"`
+	KeyFields     []string          `json:"key_fields,omitempty"` // Composite key, used instead of KeyField when set
+	Rate          bool              `json:"rate,omitempty"`
+	TTL           Duration          `json:"ttl,omitempty"`
+	Blacklist     []string          `json:"blacklist,omitempty"`
+	RateBlacklist []string          `json:"rate_blacklist,omitempty"`
+	CounterBits   uint              `json:"counter_bits,omitempty"`
+	NegativeReset bool              `json:"negative_reset,omitempty"`
+	ResetField    string            `json:"reset_field,omitempty"`
+	TimeField     string            `json:"time_field,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"` // Field:Mode, one of auto, rate, counter, gauge or string
+}
+
+// Derived defines a field computed from an expression
+type Derived struct {
+	Field      string `json:"field"`
+	Expression string `json:"expression"`
+}
+
+// Aggregate defines a run summary
+type Aggregate struct {
+	Name    string              `json:"name"`
+	GroupBy []string            `json:"group_by,omitempty"`
+	Fields  map[string][]string `json:"fields"` // Field:Functions, eg. sum, avg, min, max or count
+	Where   *Filter             `json:"where,omitempty"`
+	Drop    bool                `json:"drop,omitempty"`
+}
+
+// Join defines a join with another collector or reference table
+type Join struct {
+	Name          string   `json:"name"`
+	TTL           Duration `json:"ttl,omitempty"`
+	RefreshAfter  Duration `json:"refresh_after,omitempty"`
+	MaxStale      Duration `json:"max_stale,omitempty"`
+	JoinFields    []string `json:"join_fields,omitempty"`
+	JoinOnFields  []string `json:"join_on_fields,omitempty"`
+	JoinKeys      []*Key   `json:"join_keys,omitempty"`    // Composite keys, tried after JoinFields
+	JoinOnKeys    []*Key   `json:"join_on_keys,omitempty"` // Composite keys of the joined collector events
+	IncludeFields []string `json:"include_fields"`
+	Policy        string   `json:"policy,omitempty"` // optional, drop or quarantine
+	Node          string   `json:"node,omitempty"`   // Host name of a configured node to run the joined collector on
+	Reference     bool     `json:"reference,omitempty"`
+}
+
+// Key defines a composite key
+type Key struct {
+	Fields    []string `json:"fields"`
+	Separator string   `json:"separator,omitempty"`
+}
+
+// PostOp defines a post processing step
+type PostOp struct {
+	Name    string   `json:"name,omitempty"`
+	Op      string   `json:"op"`                 // sum, copy, parse_time or regex_extract
+	Field   string   `json:"field,omitempty"`    // Source field of copy, parse_time and regex_extract
+	To      string   `json:"to,omitempty"`       // Destination field of sum and copy
+	Fields  []string `json:"fields,omitempty"`   // Fields added by sum
+	Layout  string   `json:"layout,omitempty"`   // Time layout of parse_time
+	Regex   string   `json:"regex,omitempty"`    // Expression with named groups of regex_extract
+	OnError string   `json:"on_error,omitempty"` // drop, keep or annotate
+}
+
+// Schema defines the collector event fields
+type Schema struct {
+	Strict  bool     `json:"strict,omitempty"`
+	Invalid string   `json:"invalid,omitempty"` // log, drop, tag or quarantine
+	Fields  []*Field `json:"fields"`
+}
+
+// Field defines a schema field
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`           // number, string, bool or time
+	Kind        string `json:"kind,omitempty"` // label or metric
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Filter defines the events and fields delivered
+type Filter struct {
+	Include    []*Predicate `json:"include,omitempty"`
+	Exclude    []*Predicate `json:"exclude,omitempty"`
+	Fields     []string     `json:"fields,omitempty"`
+	OmitFields []string     `json:"omit_fields,omitempty"`
+}
+
+// Predicate defines a filter predicate
+type Predicate struct {
+	Field string `json:"field"`
+	Op    string `json:"op"` // eq, ne, glob, regex, gt, ge, lt or le
+	Value string `json:"value"`
+}
+
+// Duration is a time.Duration read from a duration string, eg. 15m, or a number of seconds
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err = json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() (data []byte, err error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Parse reads a collector spec or an array of specs in JSON or YAML
+func Parse(data []byte) (specs []*Spec, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' && data[0] != '[' {
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return nil, fmt.Errorf("spec: %s", err)
+		}
+	}
+
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &specs)
+	} else {
+		spec := &Spec{}
+		err = json.Unmarshal(data, spec)
+		specs = append(specs, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("spec: %s", err)
+	}
+	return specs, nil
+}
+
+// Load reads and compiles the collector specs from the given reader
+func Load(r io.Reader) (collectors []*tact.Collector, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	specs, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range specs {
+		collector, err := spec.Collector()
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, collector)
+	}
+	return collectors, nil
+}
+
+// Register reads, compiles and registers the collector specs from the given reader.
+// No collector is registered if any spec is invalid. Returns the registered collector names
+func Register(r io.Reader) (names []string, err error) {
+	collectors, err := Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return registerAll(collectors)
+}
+
+// RegisterDir registers the collector specs from the .json, .yaml and .yml files in the given directory,
+// in file name order. No collector is registered if any spec is invalid. Returns the registered collector names
+func RegisterDir(dir string) (names []string, err error) {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var collectors []*tact.Collector
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		loaded, err := Load(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		collectors = append(collectors, loaded...)
+	}
+	return registerAll(collectors)
+}
+
+// Unregister removes the given collectors from the registry in reverse order,
+// so collectors joining others registered before them are removed first
+func Unregister(names []string) (err error) {
+	var errs []string
+	for i := len(names) - 1; i >= 0; i-- {
+		if err = tact.Registry.Unregister(names[i]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("spec: unregistering: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// registerAll registers the collectors in order, unregistering the ones already registered if any fails
+func registerAll(collectors []*tact.Collector) (names []string, err error) {
+	for _, collector := range collectors {
+		if err = tact.Registry.Register(collector); err != nil {
+			// Keep the registry as before
+			if rerr := Unregister(names); rerr != nil {
+				return nil, fmt.Errorf("%s, %s", err, rerr)
+			}
+			return nil, err
+		}
+		names = append(names, collector.Name)
+	}
+	return names, nil
+}
+
+// Collector compiles the spec into a collector. The returned collector is validated on registration
+func (s *Spec) Collector() (collector *tact.Collector, err error) {
+	if s.Name == "" {
+		return nil, fmt.Errorf("spec: empty collector name")
+	}
+
+	collector = &tact.Collector{
+		Name:        s.Name,
+		Description: s.Description,
+		Category:    tact.Category(s.Category),
+		Platforms:   s.Platforms,
+		Schedule:    s.Schedule,
+		Timeout:     time.Duration(s.Timeout),
+		Tags:        s.Tags,
+	}
+
+	for _, credential := range s.Credentials {
+		collector.Credentials = append(collector.Credentials, tact.Credential(credential))
+	}
+
+	if collector.GetData, err = s.getData(); err != nil {
+		return nil, fmt.Errorf("spec %s: %s", s.Name, err)
+	}
+
+	if collector.EventOps, err = s.eventOps(); err != nil {
+		return nil, fmt.Errorf("spec %s: %s", s.Name, err)
+	}
+
+	for _, join := range s.Joins {
+		j, err := join.join()
+		if err != nil {
+			return nil, fmt.Errorf("spec %s: %s", s.Name, err)
+		}
+		collector.Joins = append(collector.Joins, j)
+	}
+
+	for _, op := range s.PostOps {
+		p, err := op.postOp()
+		if err != nil {
+			return nil, fmt.Errorf("spec %s: %s", s.Name, err)
+		}
+		collector.PostOps = append(collector.PostOps, p)
+	}
+
+	if s.Schema != nil {
+		if collector.Schema, err = s.Schema.schema(); err != nil {
+			return nil, fmt.Errorf("spec %s: %s", s.Name, err)
+		}
+	}
+
+	collector.Filter = s.Filter.filter()
+	return collector, nil
+}
+
+// getData builds the collector function from the command, script, file, query or helper program
+func (s *Spec) getData() (fn tact.GetDataFn, err error) {
+	var sources int
+	for _, source := range []string{s.Command, s.Script, s.File, s.Query, strings.Join(s.Exec, " ")} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of command, script, file, query or exec is required")
+	}
+
+	if len(s.Exec) > 0 {
+		if s.Parser != nil {
+			return nil, fmt.Errorf("parser is not supported with exec, use values")
+		}
+		return process.Collector(s.Exec[0], s.Exec[1:]...), nil
+	}
+
+	if s.Query != "" {
+		if s.Parser != nil {
+			return nil, fmt.Errorf("parser is not supported with query, use values")
+		}
+		query := s.Query
+		return func(ctx *tact.Context) (events <-chan []byte) {
+			return oracle.SingleQuery(ctx, query)
+		}, nil
+	}
+
+	if s.Parser == nil {
+		return nil, fmt.Errorf("parser is required with command, script or file")
+	}
+	parser, err := s.Parser.parser()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Script != "" {
+		script := ssh.NewScript(path.Base(s.Name), []byte(s.Script), s.Interpreter...)
+		return func(ctx *tact.Context) (events <-chan []byte) {
+			return ssh.RunScript(ctx, script, parser)
+		}, nil
+	}
+
+	if s.Command != "" {
+		command := s.Command
+		return func(ctx *tact.Context) (events <-chan []byte) {
+			return ssh.Regex(ctx, command, parser)
+		}, nil
+	}
+
+	file := s.File
+	return func(ctx *tact.Context) (events <-chan []byte) {
+		return sftp.Regex(ctx, file, parser)
+	}, nil
+}
+
+// eventOps builds the event ops, nil if none are defined
+func (s *Spec) eventOps() (ops *tact.EventOps, err error) {
+	if len(s.Values) == 0 && s.Round == 0 && len(s.Units) == 0 && len(s.Renames) == 0 &&
+		len(s.Deletes) == 0 && s.Delta == nil && len(s.Derived) == 0 && len(s.Aggregates) == 0 {
+		return nil, nil
+	}
+
+	ops = &tact.EventOps{
+		Round:        s.Round,
+		FieldRenames: s.Renames,
+		FieldDeletes: s.Deletes,
+	}
+
+	if ops.FieldTypes, err = values(s.Values); err != nil {
+		return nil, err
+	}
+
+	if len(s.Units) > 0 {
+		ops.Units = map[string]tact.Unit{}
+		for field, unit := range s.Units {
+			ops.Units[field] = tact.Unit(unit)
+		}
+	}
+
+	if s.Delta != nil {
+		if ops.Delta, err = s.Delta.delta(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range s.Derived {
+		ops.Derived = append(ops.Derived, &tact.Derived{Field: d.Field, Expression: d.Expression})
+	}
+
+	for _, a := range s.Aggregates {
+		ops.Aggregates = append(ops.Aggregates, &tact.Aggregate{
+			Name:    a.Name,
+			GroupBy: a.GroupBy,
+			Fields:  a.Fields,
+			Where:   a.Where.filter(),
+			Drop:    a.Drop,
+		})
+	}
+	return ops, nil
+}
+
+// parser builds the rexon parser
+func (p *Parser) parser() (parser *rexon.Parser, err error) {
+	vals, err := values(p.Values)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, fmt.Errorf("parser without values")
+	}
+
+	var opts []rexon.ParserOpt
+	if p.TrimSpaces {
+		opts = append(opts, rexon.TrimSpaces())
+	}
+	if p.LineRegex != "" {
+		opts = append(opts, rexon.LineRegex(p.LineRegex))
+	}
+	if p.FindAll {
+		opts = append(opts, rexon.FindAll())
+	}
+	if p.StartTag != "" {
+		opts = append(opts, rexon.StartTag(p.StartTag))
+	}
+	if p.StopTag != "" {
+		opts = append(opts, rexon.StopTag(p.StopTag))
+	}
+	if p.SkipTag != "" {
+		opts = append(opts, rexon.SkipTag(p.SkipTag))
+	}
+	if p.ContinueTag != "" {
+		opts = append(opts, rexon.ContinueTag(p.ContinueTag))
+	}
+
+	if parser, err = rexon.NewParser(vals, opts...); err != nil {
+		return nil, fmt.Errorf("parser: %s", err)
+	}
+	return parser, nil
+}
+
+// values builds the rexon values
+func values(specs []*Value) (vals []*rexon.Value, err error) {
+	for _, v := range specs {
+		var opts []rexon.ValueOpt
+		if v.Regex != "" {
+			opts = append(opts, rexon.ValueRegex(v.Regex))
+		}
+		if v.Round != 0 {
+			opts = append(opts, rexon.Round(v.Round))
+		}
+		if v.FromFormat != "" {
+			opts = append(opts, rexon.FromFormat(v.FromFormat))
+		}
+		if v.ToFormat != "" {
+			opts = append(opts, rexon.ToFormat(v.ToFormat))
+		}
+		if v.Nullable {
+			opts = append(opts, rexon.Nullable())
+		}
+
+		switch vt := rexon.ValueType(v.Type); vt {
+		case rexon.Number, rexon.String, rexon.Bool, rexon.Time, rexon.Duration, rexon.DigitalUnit:
+			value, err := rexon.NewValue(v.Name, vt, opts...)
+			if err != nil {
+				return nil, fmt.Errorf("value %s: %s", v.Name, err)
+			}
+			vals = append(vals, value)
+		default:
+			return nil, fmt.Errorf("value %s: invalid type %q", v.Name, v.Type)
+		}
+	}
+	return vals, nil
+}
+
+// deltaModes maps the delta mode names
+var deltaModes = map[string]tact.DeltaMode{
+	"auto":    tact.DeltaAuto,
+	"rate":    tact.DeltaRate,
+	"counter": tact.DeltaCounter,
+	"gauge":   tact.DeltaGauge,
+	"string":  tact.DeltaString,
+}
+
+// delta builds the delta ops
+func (d *Delta) delta() (ops *tact.DeltaOps, err error) {
+	ops = &tact.DeltaOps{
+		KeyField:      d.KeyField,
+		Rate:          d.Rate,
+		TTL:           time.Duration(d.TTL),
+		CounterBits:   d.CounterBits,
+		NegativeReset: d.NegativeReset,
+		ResetField:    d.ResetField,
+		TimeField:     d.TimeField,
+	}
+
+	if len(d.KeyFields) > 0 {
+		ops.Key = tact.NewKey(tact.DefaultKeySeparator, d.KeyFields...)
+	}
+	if len(d.Blacklist) > 0 {
+		ops.Blacklist = tact.Blacklist{}
+		for _, field := range d.Blacklist {
+			ops.Blacklist.Add(field)
+		}
+	}
+	if len(d.RateBlacklist) > 0 {
+		ops.RateBlacklist = tact.Blacklist{}
+		for _, field := range d.RateBlacklist {
+			ops.RateBlacklist.Add(field)
+		}
+	}
+	if len(d.Fields) > 0 {
+		ops.Fields = map[string]tact.DeltaMode{}
+		for field, name := range d.Fields {
+			mode, ok := deltaModes[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("delta field %s: invalid mode %q", field, name)
+			}
+			ops.Fields[field] = mode
+		}
+	}
+	return ops, nil
+}
+
+// join builds the join
+func (j *Join) join() (join *tact.Join, err error) {
+	join = &tact.Join{
+		Name:          j.Name,
+		TTL:           time.Duration(j.TTL),
+		RefreshAfter:  time.Duration(j.RefreshAfter),
+		MaxStale:      time.Duration(j.MaxStale),
+		JoinFields:    j.JoinFields,
+		JoinOnFields:  j.JoinOnFields,
+		JoinKeys:      compositeKeys(j.JoinKeys),
+		JoinOnKeys:    compositeKeys(j.JoinOnKeys),
+		IncludeFields: j.IncludeFields,
+		Node:          j.Node,
+		Reference:     j.Reference,
+	}
+
+	switch strings.ToLower(j.Policy) {
+	case "", "optional":
+		join.Policy = tact.JoinOptional
+	case "drop":
+		join.Policy = tact.JoinDrop
+	case "quarantine":
+		join.Policy = tact.JoinQuarantine
+	default:
+		return nil, fmt.Errorf("join %s: invalid policy %q", j.Name, j.Policy)
+	}
+	return join, nil
+}
+
+// compositeKeys builds the composite keys
+func compositeKeys(specs []*Key) (keys []*tact.Key) {
+	for _, k := range specs {
+		keys = append(keys, tact.NewKey(k.Separator, k.Fields...))
+	}
+	return keys
+}
+
+// errorPolicies maps the post op error policy names
+var errorPolicies = map[string]tact.ErrorPolicy{
+	"":         tact.OnErrorDrop,
+	"drop":     tact.OnErrorDrop,
+	"keep":     tact.OnErrorKeep,
+	"annotate": tact.OnErrorAnnotate,
+}
+
+// postOp builds the post op
+func (p *PostOp) postOp() (op *tact.PostOp, err error) {
+	name := p.Name
+	if name == "" {
+		name = p.Op
+	}
+
+	policy, ok := errorPolicies[strings.ToLower(p.OnError)]
+	if !ok {
+		return nil, fmt.Errorf("post op %s: invalid error policy %q", name, p.OnError)
+	}
+	op = &tact.PostOp{Name: name, OnError: policy}
+
+	switch strings.ToLower(p.Op) {
+	case "sum":
+		if p.To == "" || len(p.Fields) == 0 {
+			return nil, fmt.Errorf("post op %s: sum requires to and fields", name)
+		}
+		op.Fn = tact.SumFields(p.To, p.Fields...)
+	case "copy":
+		if p.Field == "" || p.To == "" {
+			return nil, fmt.Errorf("post op %s: copy requires field and to", name)
+		}
+		op.Fn = tact.CopyField(p.Field, p.To)
+	case "parse_time":
+		if p.Field == "" || p.Layout == "" {
+			return nil, fmt.Errorf("post op %s: parse_time requires field and layout", name)
+		}
+		op.Fn = tact.ParseTime(p.Field, p.Layout)
+	case "regex_extract":
+		if p.Field == "" || p.Regex == "" {
+			return nil, fmt.Errorf("post op %s: regex_extract requires field and regex", name)
+		}
+		op.Build = tact.RegexExtract(p.Field, p.Regex)
+	default:
+		return nil, fmt.Errorf("post op %s: invalid op %q", name, p.Op)
+	}
+	return op, nil
+}
+
+// invalidPolicies maps the schema invalid event policy names
+var invalidPolicies = map[string]tact.InvalidPolicy{
+	"":           tact.InvalidLog,
+	"log":        tact.InvalidLog,
+	"drop":       tact.InvalidDrop,
+	"tag":        tact.InvalidTag,
+	"quarantine": tact.InvalidQuarantine,
+}
+
+// schema builds the schema, field types and kinds are validated on registration
+func (s *Schema) schema() (schema *tact.Schema, err error) {
+	policy, ok := invalidPolicies[strings.ToLower(s.Invalid)]
+	if !ok {
+		return nil, fmt.Errorf("schema: invalid policy %q", s.Invalid)
+	}
+
+	schema = &tact.Schema{Strict: s.Strict, Invalid: policy}
+	for _, f := range s.Fields {
+		schema.Fields = append(schema.Fields, &tact.Field{
+			Name:        f.Name,
+			Type:        tact.FieldType(f.Type),
+			Kind:        tact.FieldKind(f.Kind),
+			Unit:        tact.Unit(f.Unit),
+			Description: f.Description,
+			Required:    f.Required,
+		})
+	}
+	return schema, nil
+}
+
+// filter builds the filter, nil if not defined. Predicates are validated on registration
+func (f *Filter) filter() (filter *tact.Filter) {
+	if f == nil {
+		return nil
+	}
+
+	return &tact.Filter{
+		Include:    predicates(f.Include),
+		Exclude:    predicates(f.Exclude),
+		Fields:     f.Fields,
+		OmitFields: f.OmitFields,
+	}
+}
+
+// predicates builds the filter predicates
+func predicates(specs []*Predicate) (predicates []*tact.Predicate) {
+	for _, p := range specs {
+		predicates = append(predicates, &tact.Predicate{Field: p.Field, Op: tact.Operator(p.Op), Value: p.Value})
+	}
+	return predicates
+}
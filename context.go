@@ -30,6 +30,11 @@ type Context struct {
 	dataPrefix     []byte
 	store          storage.Store
 	txn            storage.Txn
+	filter         *Filter
+	fieldMap       *FieldMap
+	nodes          map[string]*Node // Nodes joins can run their collector on, by host name
+	finished       bool             // Whether the session terminated successfully
+	joinCache      bool             // Whether the session runs a joined collector to build a join cache
 }
 
 // NewContext creates a new session
@@ -51,13 +56,21 @@ func NewContext(ctx context.Context, name string, node *Node, store storage.Stor
 	return c, nil
 }
 
-// Child creates a new session within the current session context sharing the same cache
-func (c *Context) child(name string) (child *Context, err error) {
-	if child, err = NewContext(c.ctx, name, c.node, c.store, c.timeout); err != nil {
-		return nil, err
-	}
-	child.cache = c.cache
-	return child, nil
+// SetFilter narrows the events and fields delivered in this context.
+// The filter must be compiled
+func (c *Context) SetFilter(filter *Filter) {
+	c.filter = filter
+}
+
+// SetFieldMap renames and deletes the fields of the events delivered in this context.
+// The field map must be compiled and is applied over the collector field names, after any filter
+func (c *Context) SetFieldMap(fieldMap *FieldMap) {
+	c.fieldMap = fieldMap
+}
+
+// SetNodes sets the nodes by host name that joins with a Node can run their collector on
+func (c *Context) SetNodes(nodes map[string]*Node) {
+	c.nodes = nodes
 }
 
 // Get value for the given key
@@ -130,6 +143,11 @@ func (c *Context) cancel() {
 	c.close(false)
 }
 
+// Cancel a session that will not be started, releasing its resources
+func (c *Context) Cancel() {
+	c.cancel()
+}
+
 func (c *Context) close(ok bool) (err error) {
 	if ok {
 		if err = c.storeLastTime(); err != nil {
@@ -139,6 +157,9 @@ func (c *Context) close(ok bool) (err error) {
 			return err
 		}
 		c.LogDebug("commited session data")
+		c.finished = true
+	} else {
+		c.txn.Discard()
 	}
 	c.ctxCancel()
 	c.cache = nil
@@ -163,14 +184,32 @@ func (c *Context) loadLastTime() (err error) {
 
 // EnrichEvent enriches and outgoing event
 func (c *Context) enrichEvent(event []byte) (out []byte) {
+	return c.enrichMetric(event, c.name)
+}
+
+// enrichMetric enriches and outgoing event with the given metric name
+func (c *Context) enrichMetric(event []byte, metric string) (out []byte) {
 	if !js.Has(event, keys.Time) {
 		event, _ = js.Set(event, c.currentRunTime, keys.Time)
 	}
-	event, _ = js.Set(event, c.name, keys.Metric)
+	event, _ = js.Set(event, metric, keys.Metric)
 	event, _ = js.Set(event, c.node.HostName, keys.Host)
 	return event
 }
 
+// quarantine sends the given event annotated with the error to the Quarantine sink
+func (c *Context) quarantine(event []byte, err error) {
+	if Quarantine == nil {
+		c.LogError("dropping invalid event, no quarantine sink", "error", err.Error(), "event", string(event))
+		return
+	}
+
+	event = c.enrichEvent(annotateError(event, err))
+	if !WrapCtxSend(c.ctx, Quarantine, event) {
+		c.LogError("timeout sending event to quarantine")
+	}
+}
+
 // LogInfo the given string format with given arguments
 func (c *Context) LogInfo(message string, keysAndValues ...interface{}) {
 	keysAndValues = append(keysAndValues, keys.Node, c.node.HostName, keys.Collector, c.name)
@@ -1,13 +1,20 @@
 package tact
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/brunotm/tact/log"
 	"github.com/brunotm/tact/storage"
 	"github.com/brunotm/tact/storage/badgerdb"
 )
 
+const (
+	// refreshStopTimeout is how long cancelled background cache refreshes are waited for on Close
+	refreshStopTimeout = 10 * time.Second
+)
+
 var (
 	// workingPath, _ = filepath.Abs(filepath.Dir(os.Args[0]))
 
@@ -15,6 +22,8 @@ var (
 	Registry *registry
 	// Store default persistence store
 	Store storage.Store
+	// Quarantine sink for events failing validation, when nil they are dropped
+	Quarantine chan<- []byte
 )
 
 // init the core
@@ -33,10 +42,28 @@ func Init(path string) {
 	if err != nil {
 		panic(err)
 	}
+	refreshes = newRefreshGroup()
+}
+
+// StopRefreshes cancels the background cache refreshes and waits a few seconds for them to return.
+// Refreshed collectors may deliver events to the Quarantine sink, so refreshes must be stopped
+// before closing it
+func StopRefreshes() (err error) {
+	if !refreshes.stop(refreshStopTimeout) {
+		return errors.New("background cache refreshes did not return after cancellation")
+	}
+	return nil
 }
 
-// Close shutdown and stops the core
+// Close shutdown and stops the core.
+// Running collectors must be stopped before closing, as their transactions
+// can not be committed after the Store is closed. Background cache refreshes are stopped
+// if they were not, the Store is left open if they do not return
 func Close() {
+	if err := StopRefreshes(); err != nil {
+		log.Error("not closing store", "error", err.Error())
+		return
+	}
 	if err := Store.Close(); err != nil {
 		log.Error("error closing store", "error", err.Error())
 	}
@@ -1,7 +1,9 @@
 package tact
 
 import (
+	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/brunotm/tact/collector/keys"
@@ -23,21 +25,131 @@ func (b Blacklist) Add(key string) {
 	b[key] = struct{}{}
 }
 
+// DeltaMode defines how a field is handled in delta calculations
+type DeltaMode int
+
+// Delta modes
+const (
+	DeltaAuto    DeltaMode = iota // Numeric fields are counters according to Rate, others are passed through
+	DeltaRate                     // Counter, delta over the elapsed time
+	DeltaCounter                  // Counter, delta since the previous event
+	DeltaGauge                    // Numeric value passed through
+	DeltaString                   // Value passed through, eg. labels
+)
+
 // DeltaOps type
 type DeltaOps struct {
-	KeyField      string        // Field to use as unique key
-	Rate          bool          // Wetheter or not to do rate calculations over time delta
-	TTL           time.Duration // TTL of cached data
-	Blacklist     Blacklist     // Fields to ignore in delta, can be nil
-	RateBlacklist Blacklist     // Fields to exclude from rate calculations, can be nil
+	KeyField      string               // Field to use as unique key
+	Key           *Key                 // Composite unique key, used instead of KeyField when set
+	Rate          bool                 // Wetheter or not to do rate calculations over time delta
+	TTL           time.Duration        // TTL of cached data
+	Fields        map[string]DeltaMode // Fields:Mode for explicit per field handling, can be nil
+	Blacklist     Blacklist            // Fields to ignore in delta, can be nil
+	RateBlacklist Blacklist            // Fields to exclude from rate calculations, can be nil
+	CounterBits   uint                 // Counter width for wrap detection, eg. 32. Zero disables wrap detection
+	NegativeReset bool                 // Treat a negative delta not explained by a wrap as a counter reset
+	ResetField    string               // Field with the time since counters were reset, eg. uptime. A decrease means a reset
+	TimeField     string               // Field with the event sample time to use for rates instead of the run time
 }
 
 // EventOps type
 type EventOps struct {
 	Round        int               // The precision for float fields
 	FieldTypes   []*rexon.Value    // The Fields:Type for conversion
-	FieldRenames map[string]string // The Fields:Name for renaming
+	FieldRenames map[string]string // The Fields:Name for renaming, applied after derived fields. Nested paths are dot separated
+	FieldDeletes []string          // The Fields to delete, applied after renames
+	Units        map[string]Unit   // The Fields:Unit for conversion to canonical units
 	Delta        *DeltaOps
+	Derived      []*Derived   // Fields computed from expressions, applied in order after delta and unit conversion
+	Aggregates   []*Aggregate // Summaries over the events of each run
+	fieldMap     *FieldMap
+}
+
+// init validates the event ops definitions
+func (eo *EventOps) init() (err error) {
+	for field, unit := range eo.Units {
+		if _, err = unit.Canonical(); err != nil {
+			return fmt.Errorf("field %s: %s", field, err)
+		}
+	}
+
+	for _, d := range eo.Derived {
+		if err = d.init(); err != nil {
+			return err
+		}
+	}
+
+	for _, agg := range eo.Aggregates {
+		if err = agg.init(); err != nil {
+			return err
+		}
+	}
+
+	if eo.FieldRenames != nil || eo.FieldDeletes != nil {
+		eo.fieldMap = &FieldMap{Renames: eo.FieldRenames, Deletes: eo.FieldDeletes}
+		if err = eo.fieldMap.Compile(); err != nil {
+			return err
+		}
+	}
+
+	if eo.Delta != nil {
+		if eo.Delta.Key != nil {
+			if err = eo.Delta.Key.validate(); err != nil {
+				return fmt.Errorf("delta: %s", err)
+			}
+		}
+
+		for field, mode := range eo.Delta.Fields {
+			if mode < DeltaAuto || mode > DeltaString {
+				return fmt.Errorf("field %s: invalid delta mode %d", field, mode)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRenames rejects renames of fields that are used after the event ops by their original names.
+// Post ops, schema validation, joins, filters and aggregates all see the renamed fields
+func (eo *EventOps) checkRenames(c *Collector) (err error) {
+	used := map[string]string{}
+	for _, field := range baseFields {
+		used[field.Name] = "reserved"
+	}
+	for field := range reservedFields {
+		used[field] = "reserved"
+	}
+
+	for _, join := range c.Joins {
+		for _, key := range join.keys {
+			for _, field := range key.Fields {
+				used[field] = "join " + join.Name
+			}
+		}
+	}
+
+	if c.Schema != nil {
+		for _, field := range c.Schema.Fields {
+			used[field.Name] = "schema"
+		}
+	}
+
+	for _, agg := range eo.Aggregates {
+		for _, field := range agg.GroupBy {
+			used[field] = "aggregate " + agg.Name
+		}
+		for field := range agg.Fields {
+			used[field] = "aggregate " + agg.Name
+		}
+	}
+
+	for from := range eo.FieldRenames {
+		for field, user := range used {
+			if field == from || strings.HasPrefix(field, from+".") {
+				return fmt.Errorf("field %s: renamed but used by %s", field, user)
+			}
+		}
+	}
+	return nil
 }
 
 func (eo *EventOps) process(ctx *Context, event []byte) (out []byte) {
@@ -74,6 +186,28 @@ func (eo *EventOps) process(ctx *Context, event []byte) (out []byte) {
 			ctx.LogError("%s calculating deltas for event: %s", err.Error(), event)
 			return nil
 		}
+		if event == nil {
+			return nil
+		}
+	}
+
+	// Convert fields to canonical units. Done after delta ops
+	// so counter wraps are detected over the raw values
+	if eo.Units != nil {
+		event = eo.convertUnits(ctx, event)
+	}
+
+	// Compute derived fields over the final values
+	if eo.Derived != nil {
+		event = eo.deriveFields(ctx, event)
+	}
+
+	// Rename and delete fields, the following stages only see the renamed fields
+	if eo.fieldMap != nil {
+		if event, err = eo.fieldMap.Apply(event); err != nil {
+			ctx.LogError("field map error", "error", err)
+			return nil
+		}
 	}
 
 	return event
@@ -82,8 +216,11 @@ func (eo *EventOps) process(ctx *Context, event []byte) (out []byte) {
 // eventDelta perform delta and rate calculation
 func (eo *EventOps) eventDelta(ctx *Context, event []byte) (out []byte, err error) {
 
-	// Get any specified event unique attribute key, empty string otherwise
-	keyVal, _ := js.GetUnsafeString(event, eo.Delta.KeyField)
+	// Get any specified event unique key, empty string otherwise
+	keyVal, err := eo.Delta.key(event)
+	if err != nil {
+		return nil, err
+	}
 
 	// Set the timestamp on the current event for caching
 	if !js.Has(event, keys.Time) {
@@ -107,30 +244,51 @@ func (eo *EventOps) eventDelta(ctx *Context, event []byte) (out []byte, err erro
 		return nil, err
 	}
 
-	// Store the current event
-	if err = ctx.txn.SetWithTTL(key, event, eo.Delta.TTL); err != nil {
+	// Parse the current and previous events timestamps for calculations
+	currentTimestamp, previousTimestamp, err := eo.Delta.timestamps(ctx, event, previous)
+	if err != nil {
 		return nil, err
 	}
 
-	// Parse the current and previous events, and timestamps for calculations
-	previousTimestamp, err := js.GetTime(previous, keys.Time)
-	if err != nil {
+	// Discard duplicated or out of order samples keeping the previous event as baseline
+	if !currentTimestamp.After(previousTimestamp) {
+		ctx.LogDebug("discarding duplicated or out of order sample", "key", keyVal,
+			"time", currentTimestamp, "previous_time", previousTimestamp)
+		return nil, nil
+	}
+	timeDelta := currentTimestamp.Sub(previousTimestamp).Seconds()
+
+	// Store the current event
+	if err = ctx.txn.SetWithTTL(key, event, eo.Delta.TTL); err != nil {
 		return nil, err
 	}
-	timeDelta := ctx.CurrentRunTime().Sub(previousTimestamp).Seconds()
 
-	// Loop over the event fields and perform the operations specified for each one.
+	// Check if the counters were reset since the previous event
+	reset := eo.Delta.resetSince(event, previous)
+
+	// Loop over the event fields and calculate the deltas for each one.
 	// if we get an error calculating stop return an error event to the stream
-	err = js.ForEach(event, func(key string, value []byte) error {
+	var deltas []fieldDelta
+	var wrapped bool
+	err = js.ForEachType(event, func(key string, value []byte, vt js.ValueType) error {
 		if key == keys.Time {
 			return nil
 		}
 
-		// Skip if the current field is blacklisted
-		if eo.Delta.Blacklist != nil {
-			if _, ok := eo.Delta.Blacklist[key]; ok {
-				return nil
+		// Pass through gauges and strings, and non numeric values unless explicitly counters
+		mode, explicit := eo.Delta.mode(key)
+		switch mode {
+		case DeltaString:
+			return nil
+		case DeltaGauge:
+			if vt != js.Number && vt != js.Null {
+				return fmt.Errorf("gauge field %s is not numeric", key)
 			}
+			return nil
+		}
+
+		if vt != js.Number && !explicit {
+			return nil
 		}
 
 		// Get the previous value for calculation and check its type
@@ -145,29 +303,171 @@ func (eo *EventOps) eventDelta(ctx *Context, event []byte) (out []byte, err erro
 			return err
 		}
 
-		// ctx.LogDebug("delta for key: %s, current value: %x, previous value: %x",
-		// key, currentValue, previousValue)
-
-		// Get the delta for this key
+		// Get the delta for this key, checking for counter wraps and resets
 		newValue := currentValue - previousValue
+		if newValue < 0 && !reset {
+			if wrap, ok := eo.Delta.wrap(currentValue, previousValue); ok {
+				newValue = wrap
+				wrapped = true
+			} else if eo.Delta.NegativeReset {
+				reset = true
+			}
+		}
 
-		// Check if have any rate calculation to do and if current field isn't blacklisted
-		// If not calculate and round to the precision on FieldOps.Round
-		if !eo.Delta.Rate {
-			event, err = js.Set(event, newValue, key)
-			return err
+		deltas = append(deltas, fieldDelta{key, mode, newValue})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// On counter resets the current event is the new baseline,
+	// deliver it flagged and without the counter values
+	if reset {
+		ctx.LogWarn("counter reset detected", "key", keyVal)
+		for _, d := range deltas {
+			event = js.Delete(event, d.key)
 		}
+		return js.Set(event, true, keys.CounterReset)
+	}
 
-		if _, ok := eo.Delta.RateBlacklist[key]; ok {
-			event, err = js.Set(event, newValue, key)
-			return err
+	if wrapped {
+		ctx.LogDebug("counter wrap detected", "key", keyVal)
+		if event, err = js.Set(event, true, keys.CounterWrap); err != nil {
+			return nil, err
 		}
+	}
 
-		event, err = js.Set(event, round(newValue/float64(timeDelta), eo.Round), key)
-		return err
-	})
+	// Calculate the rates over the time delta for rate fields
+	// and round to the precision on FieldOps.Round
+	for _, d := range deltas {
+		newValue := d.value
+		if d.mode == DeltaRate {
+			newValue = round(newValue/float64(timeDelta), eo.Round)
+		}
 
-	return event, err
+		if event, err = js.Set(event, newValue, d.key); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
+
+// fieldDelta holds the calculated delta for a field
+type fieldDelta struct {
+	key   string
+	mode  DeltaMode
+	value float64
+}
+
+// key returns the unique key value for the given event
+func (d *DeltaOps) key(event []byte) (value string, err error) {
+	if d.Key != nil {
+		return d.Key.Value(event)
+	}
+
+	if d.KeyField == "" {
+		return "", nil
+	}
+	return js.GetUnsafeString(event, d.KeyField)
+}
+
+// mode resolves the delta mode for the given field and whether it was explicitly set
+func (d *DeltaOps) mode(field string) (mode DeltaMode, explicit bool) {
+	if mode, ok := d.Fields[field]; ok && mode != DeltaAuto {
+		return mode, true
+	}
+
+	if field == d.ResetField {
+		return DeltaGauge, false
+	}
+
+	if field == d.TimeField {
+		return DeltaString, false
+	}
+
+	if _, ok := d.Blacklist[field]; ok {
+		return DeltaString, false
+	}
+
+	if !d.Rate {
+		return DeltaCounter, false
+	}
+
+	if _, ok := d.RateBlacklist[field]; ok {
+		return DeltaCounter, false
+	}
+	return DeltaRate, false
+}
+
+// timestamps returns the sample times of the current and previous events.
+// Without a TimeField the current run time and the previous event time are used
+func (d *DeltaOps) timestamps(ctx *Context, event, previous []byte) (current, last time.Time, err error) {
+	if d.TimeField == "" {
+		last, err = js.GetTime(previous, keys.Time)
+		return ctx.CurrentRunTime(), last, err
+	}
+
+	if current, err = eventTime(event, d.TimeField); err != nil {
+		return current, last, fmt.Errorf("current event time field %s: %s", d.TimeField, err)
+	}
+
+	if last, err = eventTime(previous, d.TimeField); err != nil {
+		return current, last, fmt.Errorf("previous event time field %s: %s", d.TimeField, err)
+	}
+	return current, last, nil
+}
+
+// eventTime parses the given field as a RFC3339 timestamp or as seconds since the unix epoch
+func eventTime(event []byte, field string) (t time.Time, err error) {
+	if js.GetType(event, field) == js.Number {
+		secs, err := js.GetFloat(event, field)
+		if err != nil {
+			return t, err
+		}
+		return time.Unix(0, int64(secs*float64(time.Second))), nil
+	}
+	return js.GetTime(event, field)
+}
+
+// resetSince checks whether the ResetField decreased since the previous event
+func (d *DeltaOps) resetSince(event, previous []byte) (reset bool) {
+	if d.ResetField == "" {
+		return false
+	}
+
+	current, err := js.GetFloat(event, d.ResetField)
+	if err != nil {
+		return false
+	}
+
+	last, err := js.GetFloat(previous, d.ResetField)
+	if err != nil {
+		return false
+	}
+
+	return current < last
+}
+
+// wrap returns the delta for a counter that wrapped at CounterBits.
+// Only deltas below a quarter of the counter range are plausible wraps,
+// larger ones mean the previous value was not close to the max and the counter was reset
+func (d *DeltaOps) wrap(current, previous float64) (delta float64, ok bool) {
+	if d.CounterBits == 0 {
+		return 0, false
+	}
+
+	max := math.Pow(2, float64(d.CounterBits))
+	if previous >= max || current >= max {
+		return 0, false
+	}
+
+	if delta = current + max - previous; delta >= max/4 {
+		return 0, false
+	}
+	return delta, true
 }
 
 // Round a float to the specified precision
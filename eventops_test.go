@@ -0,0 +1,45 @@
+package tact
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDeltaOpsWrap(t *testing.T) {
+	max32 := math.Pow(2, 32)
+	max64 := math.Pow(2, 64)
+
+	tests := []struct {
+		name     string
+		bits     uint
+		previous float64
+		current  float64
+		delta    float64
+		ok       bool
+	}{
+		{"disabled", 0, max32 - 100, 50, 0, false},
+		{"32 bit wrap", 32, max32 - 100, 50, 150, true},
+		{"32 bit wrap from max", 32, max32 - 1, 0, 1, true},
+		{"32 bit delta beyond a quarter of the range", 32, max32 * 3 / 4, max32/4 - 1, max32/2 - 1, false},
+		{"32 bit delta within a quarter of the range", 32, max32 * 7 / 8, max32/8 - 1, max32/4 - 1, true},
+		{"32 bit reset", 32, 1000, 10, 0, false},
+		{"32 bit reset from mid range", 32, max32 / 2, 10, 0, false},
+		{"previous beyond 32 bits", 32, max32 + 10, 5, 0, false},
+		{"current beyond 32 bits", 32, max32 - 10, max32 + 5, 0, false},
+		{"64 bit wrap", 64, max64 - math.Pow(2, 20), 4096, math.Pow(2, 20) + 4096, true},
+		{"64 bit reset", 64, math.Pow(2, 40), 5, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &DeltaOps{CounterBits: test.bits}
+			delta, ok := d.wrap(test.current, test.previous)
+			if ok != test.ok {
+				t.Fatalf("wrap(%v, %v) ok = %v, want %v", test.current, test.previous, ok, test.ok)
+			}
+			if ok && delta != test.delta {
+				t.Fatalf("wrap(%v, %v) delta = %v, want %v", test.current, test.previous, delta, test.delta)
+			}
+		})
+	}
+}
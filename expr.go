@@ -0,0 +1,556 @@
+package tact
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/brunotm/tact/js"
+)
+
+// Derived defines a field computed from an expression over the event fields.
+//
+// Expressions support number and string literals, null, field names,
+// the + - * / operators with the usual precedence, parentheses and the functions:
+// round(x, n), abs(x), min(x, y), max(x, y).
+// The + operator concatenates when both operands are strings, eg. maj + ":" + min
+type Derived struct {
+	Field      string // Field to set with the expression result
+	Expression string // Expression to evaluate, eg. io_rate_read_mb_avg + io_rate_write_mb_avg
+	expr       exprNode
+}
+
+// init compiles the derived field expression
+func (d *Derived) init() (err error) {
+	if d.Field == "" {
+		return fmt.Errorf("derived field with empty name")
+	}
+
+	if d.expr, err = compileExpr(d.Expression); err != nil {
+		return fmt.Errorf("derived field %s: %s", d.Field, err)
+	}
+	return nil
+}
+
+// Fields returns the event fields referenced by the expression
+func (d *Derived) Fields() (fields []string) {
+	if d.expr == nil {
+		return nil
+	}
+	return d.expr.fields(nil)
+}
+
+// apply evaluates the expression over the event and sets the result
+func (d *Derived) apply(event []byte) (out []byte, err error) {
+	value, err := d.expr.eval(event)
+	if err != nil {
+		return event, err
+	}
+	return js.Set(event, value, d.Field)
+}
+
+// deriveFields sets the derived fields in order, so expressions can reference previously derived fields
+func (eo *EventOps) deriveFields(ctx *Context, event []byte) (out []byte) {
+	for _, d := range eo.Derived {
+		derived, err := d.apply(event)
+		if err != nil {
+			ctx.LogError("derived field error", "field", d.Field, "expression", d.Expression, "error", err)
+			continue
+		}
+		event = derived
+	}
+	return event
+}
+
+// exprType is the static type of an expression, exprAny when only known at evaluation
+type exprType int
+
+const (
+	exprAny exprType = iota
+	exprNumber
+	exprString
+	exprNull
+)
+
+// exprNode is a compiled expression
+type exprNode interface {
+	eval(event []byte) (value interface{}, err error)
+	typ() exprType
+	fields(in []string) (out []string)
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+func (e *exprLiteral) eval(event []byte) (value interface{}, err error) {
+	return e.value, nil
+}
+
+func (e *exprLiteral) typ() exprType {
+	switch e.value.(type) {
+	case float64:
+		return exprNumber
+	case string:
+		return exprString
+	}
+	return exprNull
+}
+
+func (e *exprLiteral) fields(in []string) (out []string) {
+	return in
+}
+
+type exprField struct {
+	name string
+}
+
+func (e *exprField) eval(event []byte) (value interface{}, err error) {
+	value, err = js.GetValue(event, e.name)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %s", e.name, err)
+	}
+
+	switch value.(type) {
+	case float64, string, nil:
+		return value, nil
+	case int64:
+		return float64(value.(int64)), nil
+	}
+	return nil, fmt.Errorf("field %s: unsupported value type", e.name)
+}
+
+func (e *exprField) typ() exprType {
+	return exprAny
+}
+
+func (e *exprField) fields(in []string) (out []string) {
+	return append(in, e.name)
+}
+
+type exprNegate struct {
+	operand exprNode
+}
+
+func (e *exprNegate) eval(event []byte) (value interface{}, err error) {
+	if value, err = e.operand.eval(event); err != nil {
+		return nil, err
+	}
+
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", describe(value))
+	}
+	return -n, nil
+}
+
+func (e *exprNegate) typ() exprType {
+	return exprNumber
+}
+
+func (e *exprNegate) fields(in []string) (out []string) {
+	return e.operand.fields(in)
+}
+
+type exprBinary struct {
+	op          byte
+	left, right exprNode
+}
+
+func (e *exprBinary) eval(event []byte) (value interface{}, err error) {
+	left, err := e.left.eval(event)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := e.right.eval(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == '+' {
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if lok && rok {
+			return ls + rs, nil
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("invalid operands for %c: %s and %s", e.op, describe(left), describe(right))
+	}
+
+	switch e.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	}
+
+	if r == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return l / r, nil
+}
+
+func (e *exprBinary) typ() exprType {
+	if e.op == '+' && e.left.typ() == exprString {
+		return exprString
+	}
+	if e.op == '+' && e.left.typ() == exprAny && e.right.typ() != exprNumber {
+		return exprAny
+	}
+	return exprNumber
+}
+
+func (e *exprBinary) fields(in []string) (out []string) {
+	return e.right.fields(e.left.fields(in))
+}
+
+type exprCall struct {
+	name string
+	fn   func(args []float64) float64
+	args []exprNode
+}
+
+// exprFuncs are the functions available in expressions with their arity
+var exprFuncs = map[string]struct {
+	arity int
+	fn    func(args []float64) float64
+}{
+	"round": {2, func(args []float64) float64 { return round(args[0], int(args[1])) }},
+	"abs":   {1, func(args []float64) float64 { return math.Abs(args[0]) }},
+	"min":   {2, func(args []float64) float64 { return math.Min(args[0], args[1]) }},
+	"max":   {2, func(args []float64) float64 { return math.Max(args[0], args[1]) }},
+}
+
+func (e *exprCall) eval(event []byte) (value interface{}, err error) {
+	args := make([]float64, len(e.args))
+	for i := range e.args {
+		if value, err = e.args[i].eval(event); err != nil {
+			return nil, err
+		}
+
+		n, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid argument %s", e.name, describe(value))
+		}
+		args[i] = n
+	}
+	return e.fn(args), nil
+}
+
+func (e *exprCall) typ() exprType {
+	return exprNumber
+}
+
+func (e *exprCall) fields(in []string) (out []string) {
+	for _, arg := range e.args {
+		in = arg.fields(in)
+	}
+	return in
+}
+
+// describe a value for error messages
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// compileExpr parses the expression and checks the operand types known at compile time
+func compileExpr(src string) (node exprNode, err error) {
+	p := &exprParser{src: src}
+	if err = p.next(); err != nil {
+		return nil, err
+	}
+
+	if node, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+
+	if p.tok != tokEOF {
+		return nil, p.errorf("unexpected %s", p.text)
+	}
+
+	if err = checkExpr(node); err != nil {
+		return nil, fmt.Errorf("expression %q: %s", src, err)
+	}
+	return node, nil
+}
+
+// checkExpr rejects operations over literals of invalid types, eg. "a" * 2
+func checkExpr(node exprNode) (err error) {
+	switch n := node.(type) {
+	case *exprNegate:
+		if err = checkExpr(n.operand); err != nil {
+			return err
+		}
+		if t := n.operand.typ(); t == exprString || t == exprNull {
+			return fmt.Errorf("cannot negate a non numeric value")
+		}
+
+	case *exprBinary:
+		if err = checkExpr(n.left); err != nil {
+			return err
+		}
+		if err = checkExpr(n.right); err != nil {
+			return err
+		}
+
+		lt, rt := n.left.typ(), n.right.typ()
+		if lt == exprNull || rt == exprNull {
+			return fmt.Errorf("invalid null operand for %c", n.op)
+		}
+		if n.op != '+' && (lt == exprString || rt == exprString) {
+			return fmt.Errorf("invalid string operand for %c", n.op)
+		}
+		if n.op == '+' && lt != exprAny && rt != exprAny && lt != rt {
+			return fmt.Errorf("mismatched operand types for +")
+		}
+
+	case *exprCall:
+		for _, arg := range n.args {
+			if err = checkExpr(arg); err != nil {
+				return err
+			}
+			if t := arg.typ(); t == exprString || t == exprNull {
+				return fmt.Errorf("%s: invalid non numeric argument", n.name)
+			}
+		}
+	}
+	return nil
+}
+
+type exprToken int
+
+const (
+	tokEOF exprToken = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+// exprParser is a recursive descent parser for derived field expressions
+type exprParser struct {
+	src  string
+	pos  int
+	tok  exprToken
+	text string
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q: position %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+// next scans the next token
+func (p *exprParser) next() (err error) {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+
+	if p.pos >= len(p.src) {
+		p.tok, p.text = tokEOF, "end of expression"
+		return nil
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = tokNumber
+
+	case isIdentStart(c):
+		for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = tokIdent
+
+	case c == '"' || c == '\'':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != c {
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return p.errorf("unterminated string")
+		}
+		p.pos++
+		p.tok, p.text = tokString, p.src[start+1:p.pos-1]
+		return nil
+
+	case strings.IndexByte("+-*/(),", c) >= 0:
+		p.pos++
+		p.tok = tokOp
+
+	default:
+		return p.errorf("unexpected character %q", c)
+	}
+
+	p.text = p.src[start:p.pos]
+	return nil
+}
+
+// expect consumes the given operator
+func (p *exprParser) expect(op string) (err error) {
+	if p.tok != tokOp || p.text != op {
+		return p.errorf("expected %s, found %s", op, p.text)
+	}
+	return p.next()
+}
+
+// parseExpr parses additions and subtractions
+func (p *exprParser) parseExpr() (node exprNode, err error) {
+	if node, err = p.parseTerm(); err != nil {
+		return nil, err
+	}
+
+	for p.tok == tokOp && (p.text == "+" || p.text == "-") {
+		op := p.text[0]
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		node = &exprBinary{op: op, left: node, right: right}
+	}
+	return node, nil
+}
+
+// parseTerm parses multiplications and divisions
+func (p *exprParser) parseTerm() (node exprNode, err error) {
+	if node, err = p.parseUnary(); err != nil {
+		return nil, err
+	}
+
+	for p.tok == tokOp && (p.text == "*" || p.text == "/") {
+		op := p.text[0]
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node = &exprBinary{op: op, left: node, right: right}
+	}
+	return node, nil
+}
+
+// parseUnary parses negations
+func (p *exprParser) parseUnary() (node exprNode, err error) {
+	if p.tok == tokOp && p.text == "-" {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		if node, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		return &exprNegate{operand: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses literals, fields, function calls and parenthesized expressions
+func (p *exprParser) parsePrimary() (node exprNode, err error) {
+	text := p.text
+
+	switch p.tok {
+	case tokNumber:
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", text)
+		}
+		return &exprLiteral{value: n}, p.next()
+
+	case tokString:
+		return &exprLiteral{value: text}, p.next()
+
+	case tokIdent:
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		if text == "null" {
+			return &exprLiteral{value: nil}, nil
+		}
+
+		if p.tok == tokOp && p.text == "(" {
+			return p.parseCall(text)
+		}
+		return &exprField{name: text}, nil
+
+	case tokOp:
+		if text == "(" {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+
+			if node, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		}
+	}
+	return nil, p.errorf("unexpected %s", text)
+}
+
+// parseCall parses the arguments of a function call
+func (p *exprParser) parseCall(name string) (node exprNode, err error) {
+	f, ok := exprFuncs[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+
+	if err = p.expect("("); err != nil {
+		return nil, err
+	}
+
+	call := &exprCall{name: name, fn: f.fn}
+	for !(p.tok == tokOp && p.text == ")") {
+		if len(call.args) > 0 {
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+
+	if len(call.args) != f.arity {
+		return nil, p.errorf("%s expects %d arguments, found %d", name, f.arity, len(call.args))
+	}
+	return call, p.next()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
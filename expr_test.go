@@ -0,0 +1,108 @@
+package tact
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end of expression"},
+		{"a +", "unexpected end of expression"},
+		{"(a + b", "expected )"},
+		{"a b", "unexpected b"},
+		{"a % b", "unexpected character"},
+		{`"abc`, "unterminated string"},
+		{"1.2.3", "invalid number"},
+		{"sqrt(a)", "unknown function sqrt"},
+		{"round(a)", "round expects 2 arguments, found 1"},
+		{"abs(a, b)", "abs expects 1 arguments, found 2"},
+		{"min(a b)", "expected ,"},
+		{`"a" * 2`, "invalid string operand for *"},
+		{`2 - "a"`, "invalid string operand for -"},
+		{`"a" + 1`, "mismatched operand types for +"},
+		{"null + 1", "invalid null operand for +"},
+		{`-"a"`, "cannot negate a non numeric value"},
+		{"-null", "cannot negate a non numeric value"},
+		{`abs("a")`, "abs: invalid non numeric argument"},
+		{`max(a, "b" + c)`, "max: invalid non numeric argument"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := compileExpr(test.expr)
+			if err == nil {
+				t.Fatalf("compileExpr(%q) succeeded, want error %q", test.expr, test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("compileExpr(%q) error = %q, want %q", test.expr, err, test.err)
+			}
+		})
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	event := []byte(`{"a":1,"b":2,"c":4,"maj":"8","min":"1","zero":0,"s":"x","n":null}`)
+
+	tests := []struct {
+		expr   string
+		value  interface{}
+		err    string
+		fields []string
+	}{
+		{expr: "a + b", value: 3.0, fields: []string{"a", "b"}},
+		{expr: "a + b * c", value: 9.0, fields: []string{"a", "b", "c"}},
+		{expr: "(a + b) * c", value: 12.0, fields: []string{"a", "b", "c"}},
+		{expr: "c - b - a", value: 1.0, fields: []string{"c", "b", "a"}},
+		{expr: "c / b / 2", value: 1.0, fields: []string{"c", "b"}},
+		{expr: "-a + b", value: 1.0, fields: []string{"a", "b"}},
+		{expr: "--a", value: 1.0, fields: []string{"a"}},
+		{expr: "a * -b", value: -2.0, fields: []string{"a", "b"}},
+		{expr: "a / 3", value: 1.0 / 3, fields: []string{"a"}},
+		{expr: "round(a / 3, 2)", value: 0.33, fields: []string{"a"}},
+		{expr: "round(2.5, 0)", value: 3.0},
+		{expr: "abs(a - c)", value: 3.0, fields: []string{"a", "c"}},
+		{expr: "max(a, b) - min(a, c)", value: 1.0, fields: []string{"a", "b", "a", "c"}},
+		{expr: "0.5 * c", value: 2.0, fields: []string{"c"}},
+		{expr: `maj + ":" + min`, value: "8:1", fields: []string{"maj", "min"}},
+		{expr: `'dev' + "-" + s`, value: "dev-x", fields: []string{"s"}},
+		{expr: "c / zero", err: "division by zero"},
+		{expr: "missing + 1", err: "field missing"},
+		{expr: "s * 2", err: `invalid operands for *: "x" and 2`},
+		{expr: "maj + 1", err: `invalid operands for +: "8" and 1`},
+		{expr: "n + a", err: "invalid operands for +: null and 1"},
+		{expr: "-s", err: "cannot negate"},
+		{expr: "abs(s)", err: `abs: invalid argument "x"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			node, err := compileExpr(test.expr)
+			if err != nil {
+				t.Fatalf("compileExpr(%q) error: %s", test.expr, err)
+			}
+
+			value, err := node.eval(event)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("eval(%q) = %v, %v, want error %q", test.expr, value, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("eval(%q) error: %s", test.expr, err)
+			}
+
+			if value != test.value {
+				t.Fatalf("eval(%q) = %#v, want %#v", test.expr, value, test.value)
+			}
+			if fields := node.fields(nil); !reflect.DeepEqual(fields, test.fields) {
+				t.Fatalf("fields(%q) = %v, want %v", test.expr, fields, test.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package tact
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brunotm/tact/js"
+)
+
+// FieldMap renames, moves and deletes event fields.
+// Nested paths are dot separated, eg. renaming read_mb to io.read.mb moves the field into nested objects
+type FieldMap struct {
+	Renames  map[string]string // Field:NewName, applied all at once so renames can be chained or swapped
+	Deletes  []string          // Fields to delete, applied after renames
+	renames  []fieldRename
+	deletes  [][]string
+	compiled bool
+}
+
+// fieldRename holds the parsed paths of a rename
+type fieldRename struct {
+	from, to []string
+}
+
+// Compile validates the field map and parses its paths.
+// Collector field maps are compiled by Registry.Add, job field maps by the scheduler
+func (m *FieldMap) Compile() (err error) {
+	if m.compiled {
+		return nil
+	}
+
+	// Sort for a deterministic order when setting nested paths
+	sources := make([]string, 0, len(m.Renames))
+	for from := range m.Renames {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+
+	targets := map[string]string{}
+	m.renames = m.renames[:0]
+	for _, from := range sources {
+		to := m.Renames[from]
+
+		fromPath, err := fieldPath(from)
+		if err != nil {
+			return fmt.Errorf("rename %s: %s", from, err)
+		}
+
+		toPath, err := fieldPath(to)
+		if err != nil {
+			return fmt.Errorf("rename %s: %s", from, err)
+		}
+
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("rename %s: target %s already renamed from %s", from, to, other)
+		}
+		targets[to] = from
+
+		m.renames = append(m.renames, fieldRename{from: fromPath, to: toPath})
+	}
+
+	m.deletes = m.deletes[:0]
+	for _, field := range m.Deletes {
+		path, err := fieldPath(field)
+		if err != nil {
+			return fmt.Errorf("delete: %s", err)
+		}
+		m.deletes = append(m.deletes, path)
+	}
+
+	m.compiled = true
+	return nil
+}
+
+// fieldPath splits a dot separated field path
+func fieldPath(field string) (path []string, err error) {
+	path = strings.Split(field, ".")
+	for _, el := range path {
+		if el == "" {
+			return nil, fmt.Errorf("invalid field path %q", field)
+		}
+	}
+	return path, nil
+}
+
+// Apply the renames and deletes to the given event
+func (m *FieldMap) Apply(event []byte) (out []byte, err error) {
+	values := make([][]byte, len(m.renames))
+	for i, r := range m.renames {
+		if values[i], err = js.Get(event, r.from...); err != nil {
+			values[i] = nil
+			continue
+		}
+		// Copy the value, as the event is modified before setting it
+		values[i] = append([]byte(nil), values[i]...)
+
+		// js.Get strips the quotes from strings
+		if js.GetType(event, r.from...) == js.String {
+			values[i] = append(append([]byte{'"'}, values[i]...), '"')
+		}
+	}
+
+	for i, r := range m.renames {
+		if values[i] != nil {
+			event = js.Delete(event, r.from...)
+		}
+	}
+
+	for i, r := range m.renames {
+		if values[i] == nil {
+			continue
+		}
+		if event, err = js.SetRawBytes(event, values[i], r.to...); err != nil {
+			return nil, fmt.Errorf("rename %s: %s", strings.Join(r.from, "."), err)
+		}
+	}
+
+	for _, path := range m.deletes {
+		event = js.Delete(event, path...)
+	}
+	return event, nil
+}
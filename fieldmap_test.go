@@ -0,0 +1,131 @@
+package tact
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldMapApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		renames map[string]string
+		deletes []string
+		event   string
+		want    string
+	}{
+		{
+			name:    "rename",
+			renames: map[string]string{"read_mb": "read"},
+			event:   `{"dev":"sda","read_mb":1.5}`,
+			want:    `{"dev":"sda","read":1.5}`,
+		},
+		{
+			name:    "swap",
+			renames: map[string]string{"a": "b", "b": "a"},
+			event:   `{"a":1,"b":"two"}`,
+			want:    `{"a":"two","b":1}`,
+		},
+		{
+			name:    "chain",
+			renames: map[string]string{"a": "b", "b": "c"},
+			event:   `{"a":1,"b":2}`,
+			want:    `{"b":1,"c":2}`,
+		},
+		{
+			name:    "move into nested objects",
+			renames: map[string]string{"read_mb": "io.read.mb", "write_mb": "io.write.mb"},
+			event:   `{"dev":"sda","read_mb":1,"write_mb":2}`,
+			want:    `{"dev":"sda","io":{"read":{"mb":1},"write":{"mb":2}}}`,
+		},
+		{
+			name:    "move out of nested objects",
+			renames: map[string]string{"io.read": "read"},
+			event:   `{"io":{"read":{"mb":1},"write":2}}`,
+			want:    `{"io":{"write":2},"read":{"mb":1}}`,
+		},
+		{
+			name:    "missing source",
+			renames: map[string]string{"missing": "other", "a": "b"},
+			event:   `{"a":1}`,
+			want:    `{"b":1}`,
+		},
+		{
+			name:    "string values keep their escapes",
+			renames: map[string]string{"msg": "message"},
+			event:   `{"msg":"say \"hi\"\n"}`,
+			want:    `{"message":"say \"hi\"\n"}`,
+		},
+		{
+			name:    "null and array values",
+			renames: map[string]string{"n": "null_value", "l": "list"},
+			event:   `{"n":null,"l":[1,"a"]}`,
+			want:    `{"null_value":null,"list":[1,"a"]}`,
+		},
+		{
+			name:    "delete",
+			deletes: []string{"secret", "io.write", "missing"},
+			event:   `{"dev":"sda","secret":"x","io":{"read":1,"write":2}}`,
+			want:    `{"dev":"sda","io":{"read":1}}`,
+		},
+		{
+			name:    "delete after renames",
+			renames: map[string]string{"a": "b"},
+			deletes: []string{"b"},
+			event:   `{"a":1,"b":2}`,
+			want:    `{}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &FieldMap{Renames: test.renames, Deletes: test.deletes}
+			if err := m.Compile(); err != nil {
+				t.Fatalf("compile error: %s", err)
+			}
+
+			out, err := m.Apply([]byte(test.event))
+			if err != nil {
+				t.Fatalf("apply error: %s", err)
+			}
+
+			var got, want interface{}
+			if err = json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("invalid event %s: %s", out, err)
+			}
+			if err = json.Unmarshal([]byte(test.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("apply(%s) = %s, want %s", test.event, out, test.want)
+			}
+		})
+	}
+}
+
+func TestFieldMapCompileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		renames map[string]string
+		deletes []string
+		err     string
+	}{
+		{"empty source", map[string]string{"": "a"}, nil, `invalid field path ""`},
+		{"empty target", map[string]string{"a": ""}, nil, `invalid field path ""`},
+		{"empty path element", map[string]string{"a": "io..read"}, nil, `invalid field path "io..read"`},
+		{"trailing dot", map[string]string{"a.": "b"}, nil, `invalid field path "a."`},
+		{"duplicate target", map[string]string{"a": "c", "b": "c"}, nil, "target c already renamed from a"},
+		{"invalid delete", nil, []string{".a"}, `invalid field path ".a"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &FieldMap{Renames: test.renames, Deletes: test.deletes}
+			err := m.Compile()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("compile error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
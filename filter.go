@@ -0,0 +1,191 @@
+package tact
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/brunotm/tact/js"
+)
+
+// Operator of a filter predicate
+type Operator string
+
+// Predicate operators. Ordering operators compare numerically
+const (
+	OpEq    Operator = "eq"
+	OpNe    Operator = "ne"
+	OpGlob  Operator = "glob"  // Shell pattern, eg. loop*
+	OpRegex Operator = "regex" // Regular expression
+	OpGt    Operator = "gt"
+	OpGe    Operator = "ge"
+	OpLt    Operator = "lt"
+	OpLe    Operator = "le"
+)
+
+// Predicate tests an event field. A missing or null field never matches
+type Predicate struct {
+	Field string
+	Op    Operator
+	Value string
+	re    *regexp.Regexp
+	num   float64
+}
+
+// Filter selects the events and fields delivered for a collector
+type Filter struct {
+	Include    []*Predicate // When set, only events matching any of the predicates are delivered
+	Exclude    []*Predicate // Events matching any of the predicates are dropped
+	Fields     []string     // When set, only these fields are delivered
+	OmitFields []string     // Fields removed from the delivered events
+	compiled   bool
+}
+
+// Compile validates the filter and compiles its predicates.
+// Collector filters are compiled by Registry.Add, job filters by the scheduler
+func (f *Filter) Compile() (err error) {
+	if f.compiled {
+		return nil
+	}
+
+	for _, predicates := range [][]*Predicate{f.Include, f.Exclude} {
+		for _, p := range predicates {
+			if err = p.compile(); err != nil {
+				return err
+			}
+		}
+	}
+
+	f.compiled = true
+	return nil
+}
+
+// compile validates the predicate operator and value
+func (p *Predicate) compile() (err error) {
+	if p.Field == "" {
+		return fmt.Errorf("filter: predicate with empty field")
+	}
+
+	switch p.Op {
+	case OpEq, OpNe:
+	case OpGlob:
+		if _, err = path.Match(p.Value, ""); err != nil {
+			return fmt.Errorf("filter: field %s: invalid pattern %q", p.Field, p.Value)
+		}
+	case OpRegex:
+		if p.re, err = regexp.Compile(p.Value); err != nil {
+			return fmt.Errorf("filter: field %s: %s", p.Field, err)
+		}
+	case OpGt, OpGe, OpLt, OpLe:
+		if p.num, err = strconv.ParseFloat(p.Value, 64); err != nil {
+			return fmt.Errorf("filter: field %s: invalid number %q", p.Field, p.Value)
+		}
+	default:
+		return fmt.Errorf("filter: field %s: invalid operator %q", p.Field, p.Op)
+	}
+	return nil
+}
+
+// Match tests the predicate against the given event
+func (p *Predicate) Match(event []byte) (ok bool) {
+	raw, err := js.Get(event, p.Field)
+	if err != nil {
+		return false
+	}
+
+	vt := js.GetType(event, p.Field)
+	if vt == js.Null {
+		return false
+	}
+
+	value := string(raw)
+	if vt == js.String {
+		if value, err = js.GetString(event, p.Field); err != nil {
+			return false
+		}
+	}
+
+	switch p.Op {
+	case OpEq:
+		return value == p.Value
+	case OpNe:
+		return value != p.Value
+	case OpGlob:
+		ok, _ = path.Match(p.Value, value)
+		return ok
+	case OpRegex:
+		return p.re.MatchString(value)
+	}
+
+	if vt != js.Number {
+		return false
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	switch p.Op {
+	case OpGt:
+		return n > p.num
+	case OpGe:
+		return n >= p.num
+	case OpLt:
+		return n < p.num
+	case OpLe:
+		return n <= p.num
+	}
+	return false
+}
+
+// Match tests whether the event is selected by the filter include and exclude predicates
+func (f *Filter) Match(event []byte) (ok bool) {
+	if len(f.Include) > 0 {
+		for _, p := range f.Include {
+			if ok = p.Match(event); ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	for _, p := range f.Exclude {
+		if p.Match(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// Project removes the fields not selected by the filter.
+// Annotations such as _errors are always kept
+func (f *Filter) Project(event []byte) (out []byte) {
+	if len(f.Fields) > 0 {
+		var remove []string
+		js.ForEach(event, func(key string, value []byte) error {
+			if _, ok := reservedFields[key]; ok {
+				return nil
+			}
+			for _, field := range f.Fields {
+				if field == key {
+					return nil
+				}
+			}
+			remove = append(remove, key)
+			return nil
+		})
+
+		for _, key := range remove {
+			event = js.Delete(event, key)
+		}
+	}
+
+	for _, field := range f.OmitFields {
+		event = js.Delete(event, field)
+	}
+	return event
+}
@@ -1,28 +1,36 @@
 module github.com/brunotm/tact
 
+go 1.27.1
+
 require (
-	github.com/AndreasBriese/bbloom v0.0.0-20180913140656-343706a395b7 // indirect
 	github.com/brunotm/rexon v0.0.0-20180610092326-8965f1e0ed99
 	github.com/brunotm/sema v0.0.0-20180508223850-2383890bbd0e
-	github.com/brunotm/sshmgr v0.0.0-20180915212940-09ed004493e9
 	github.com/buger/jsonparser v0.0.0-20181115193947-bf1c66bbce23
-	github.com/cespare/xxhash v1.1.0 // indirect
 	github.com/dgraph-io/badger v1.5.4
-	github.com/dgryski/go-farm v0.0.0-20180109070241-2de33835d102 // indirect
+	github.com/ghodss/yaml v1.0.1-0.20190212211648-25d852aebe32
 	github.com/gogo/protobuf v1.2.0
-	github.com/golang/protobuf v1.2.0 // indirect
 	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db
-	github.com/kr/fs v0.1.0 // indirect
 	github.com/mattn/go-oci8 v0.0.0-20181219054606-247e199a1d6b
 	github.com/minio/blake2b-simd v0.0.0-20160723061019-3f5f724cb5b1
-	github.com/pkg/errors v0.8.0 // indirect
-	github.com/pkg/sftp v1.8.3 // indirect
+	github.com/pkg/sftp v1.8.3
 	github.com/robfig/cron v0.0.0-20180505203441-b41be1df6967
 	github.com/vmware/govmomi v0.19.0
+	go.uber.org/zap v1.9.1
+	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9
+)
+
+require (
+	github.com/AndreasBriese/bbloom v0.0.0-20180913140656-343706a395b7 // indirect
+	github.com/OneOfOne/xxhash v1.2.2 // indirect
+	github.com/cespare/xxhash v1.1.0 // indirect
+	github.com/dgryski/go-farm v0.0.0-20180109070241-2de33835d102 // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/spaolacci/murmur3 v0.0.0-20180118202830-f09979ecbc72 // indirect
 	go.uber.org/atomic v1.3.2 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
-	go.uber.org/zap v1.9.1
-	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9 // indirect
 	golang.org/x/net v0.0.0-20181217023233-e147a9138326 // indirect
 	golang.org/x/sys v0.0.0-20181218192612-074acd46bca6 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
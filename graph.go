@@ -0,0 +1,235 @@
+package tact
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphError holds the problems found in the collector dependency graph
+type GraphError struct {
+	Missing map[string][]string // Collector:Joined collectors not registered
+	Cycles  [][]string          // Dependency cycles
+}
+
+func (e *GraphError) Error() string {
+	var errs []string
+
+	names := make([]string, 0, len(e.Missing))
+	for name := range e.Missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		errs = append(errs, fmt.Sprintf("collector %s joins unregistered %s", name, strings.Join(e.Missing[name], ", ")))
+	}
+	for _, cycle := range e.Cycles {
+		errs = append(errs, fmt.Sprintf("dependency cycle %s", strings.Join(cycle, " -> ")))
+	}
+	return "registry: " + strings.Join(errs, "; ")
+}
+
+// dependencies returns the names of the collectors joined by the given collector
+func dependencies(collector *Collector) (deps []string) {
+	seen := map[string]struct{}{}
+	for _, join := range collector.Joins {
+		if join.Reference {
+			continue
+		}
+		if _, ok := seen[join.Name]; ok {
+			continue
+		}
+		seen[join.Name] = struct{}{}
+		deps = append(deps, join.Name)
+	}
+	return deps
+}
+
+// Dependencies returns the collectors joined by the given collector
+func (r *registry) Dependencies(name string) (deps []string) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if collector, ok := r.collectors[name]; ok {
+		return dependencies(collector)
+	}
+	return nil
+}
+
+// Dependents returns the collectors joining the given collector
+func (r *registry) Dependents(name string) (dependents []string) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, collector := range r.collectors {
+		for _, dep := range dependencies(collector) {
+			if dep == name {
+				dependents = append(dependents, collector.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// cycleLocked returns the dependency cycle reaching the given collector from its dependencies, if any
+func (r *registry) cycleLocked(collector *Collector) (cycle []string) {
+	visited := map[string]bool{}
+
+	var visit func(name string, path []string) []string
+	visit = func(name string, path []string) []string {
+		path = append(path, name)
+		if name == collector.Name {
+			return path
+		}
+		if visited[name] {
+			return nil
+		}
+		visited[name] = true
+
+		dep, ok := r.collectors[name]
+		if !ok {
+			return nil
+		}
+		for _, next := range dependencies(dep) {
+			if found := visit(next, path); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	for _, dep := range dependencies(collector) {
+		if found := visit(dep, []string{collector.Name}); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Validate the collector dependency graph, all joined collectors must be registered and there must be no cycles.
+// Must be called after all collectors are registered, as registration order is not defined
+func (r *registry) Validate() (err error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	gerr := &GraphError{Missing: map[string][]string{}}
+	reported := map[string]bool{}
+
+	for _, name := range r.namesLocked() {
+		collector := r.collectors[name]
+		for _, dep := range dependencies(collector) {
+			if _, ok := r.collectors[dep]; !ok {
+				gerr.Missing[name] = append(gerr.Missing[name], dep)
+			}
+		}
+
+		if reported[name] {
+			continue
+		}
+		if cycle := r.cycleLocked(collector); cycle != nil {
+			for _, member := range cycle {
+				reported[member] = true
+			}
+			gerr.Cycles = append(gerr.Cycles, cycle)
+		}
+	}
+
+	if len(gerr.Missing) > 0 || len(gerr.Cycles) > 0 {
+		return gerr
+	}
+	return nil
+}
+
+// Order returns the given collectors and their transitive dependencies in dependency order,
+// joined collectors first. All registered collectors are ordered when no names are given
+func (r *registry) Order(names ...string) (order []string, err error) {
+	if err = r.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if len(names) == 0 {
+		names = r.namesLocked()
+	}
+
+	visited := map[string]bool{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		visited[name] = true
+
+		collector, ok := r.collectors[name]
+		if !ok {
+			return fmt.Errorf("registry: collector %s does not exist", name)
+		}
+
+		deps := dependencies(collector)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err = visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// WriteGraph writes the dependency graph of the given collectors in the Graphviz DOT format.
+// Edges point from a collector to the collectors and reference tables it joins
+func (r *registry) WriteGraph(w io.Writer, names ...string) (err error) {
+	order, err := r.Order(names...)
+	if err != nil {
+		return err
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	lines := []string{"digraph tact {", "\trankdir=LR;"}
+	for _, name := range order {
+		lines = append(lines, fmt.Sprintf("\t%q;", name))
+		for _, join := range r.collectors[name].Joins {
+			if join.Reference {
+				lines = append(lines, fmt.Sprintf("\t%q [shape=box];", "reference:"+join.Name))
+				lines = append(lines, fmt.Sprintf("\t%q -> %q;", name, "reference:"+join.Name))
+				continue
+			}
+
+			attrs := ""
+			if join.Node != "" {
+				attrs = fmt.Sprintf(" [label=%q]", join.Node)
+			}
+			lines = append(lines, fmt.Sprintf("\t%q -> %q%s;", name, join.Name, attrs))
+		}
+	}
+	lines = append(lines, "}")
+
+	_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// namesLocked returns the sorted names of the registered collectors
+func (r *registry) namesLocked() (names []string) {
+	names = make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
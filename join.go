@@ -4,23 +4,89 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/brunotm/tact/collector/keys"
 	"github.com/brunotm/tact/js"
 )
 
+// JoinPolicy defines how events without a join match are handled
+type JoinPolicy int
+
+// Join policies
+const (
+	JoinOptional   JoinPolicy = iota // Deliver the event annotated with the join name in _join_missing
+	JoinDrop                         // Join is required, log and drop the event
+	JoinQuarantine                   // Join is required, route the event to the Quarantine sink
+)
+
 // Join type
 type Join struct {
 	Name          string        // Collector name eg. `/aix/config/lvm`
 	TTL           time.Duration // TTL when using cache
+	RefreshAfter  time.Duration // Age after which the cache is refreshed in background while still served, zero disables
+	MaxStale      time.Duration // How long past its TTL the cache is served when refreshing fails, zero disables
 	JoinFields    []string      // Field names for possible matches to join, it will successfully return on first match
 	JoinOnFields  []string      // Field name from the events of called Collector to join on
+	JoinKeys      []*Key        // Composite keys for possible matches to join, tried after JoinFields
+	JoinOnKeys    []*Key        // Composite keys from the events of called Collector to join on
 	IncludeFields []string      // Fields to include from the events of called collector
+	Policy        JoinPolicy    // How to handle events without a match
+	Node          string        // Name of the node to run the joined collector on, eg. a storage management host. The event node when empty
+	Reference     bool          // Join from the reference table Name imported with ImportReference instead of a collector
+	keys          []*Key
+	onKeys        []*Key
+}
+
+// JoinStats holds the match counters of a join in a collector run
+type JoinStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// init validates the join definitions and builds its keys
+func (j *Join) init() (err error) {
+	j.keys = make([]*Key, 0, len(j.JoinFields)+len(j.JoinKeys))
+	for _, field := range j.JoinFields {
+		j.keys = append(j.keys, NewKey("", field))
+	}
+	j.keys = append(j.keys, j.JoinKeys...)
+
+	j.onKeys = make([]*Key, 0, len(j.JoinOnFields)+len(j.JoinOnKeys))
+	for _, field := range j.JoinOnFields {
+		j.onKeys = append(j.onKeys, NewKey("", field))
+	}
+	j.onKeys = append(j.onKeys, j.JoinOnKeys...)
+
+	if j.RefreshAfter < 0 || j.MaxStale < 0 || (j.RefreshAfter > 0 && j.RefreshAfter >= j.TTL) {
+		return fmt.Errorf("join %s: refresh after must be positive and before the TTL, max stale positive", j.Name)
+	}
+
+	if j.Reference && j.Node != "" {
+		return fmt.Errorf("join %s: reference tables are not node specific", j.Name)
+	}
+
+	switch j.Policy {
+	case JoinOptional, JoinDrop, JoinQuarantine:
+	default:
+		return fmt.Errorf("join %s: invalid policy %d", j.Name, j.Policy)
+	}
+
+	if len(j.keys) == 0 || len(j.onKeys) == 0 {
+		return fmt.Errorf("join %s: empty join keys", j.Name)
+	}
+
+	for _, key := range append(j.keys, j.onKeys...) {
+		if err = key.validate(); err != nil {
+			return fmt.Errorf("join %s: %s", j.Name, err)
+		}
+	}
+	return nil
 }
 
 // Process joins for the given event
 func (j *Join) Process(ctx *Context, event []byte) (joined []byte, ok bool) {
-	// Try to join on each specified field until matched
-	for field := range j.JoinFields {
-		if event, ok := j.join(ctx, event, j.JoinFields[field]); ok {
+	// Try to join on each specified key until matched
+	for _, key := range j.keys {
+		if event, ok := j.join(ctx, event, key); ok {
 			return event, ok
 		}
 	}
@@ -28,9 +94,32 @@ func (j *Join) Process(ctx *Context, event []byte) (joined []byte, ok bool) {
 	return event, false
 }
 
-func (j *Join) join(ctx *Context, event []byte, joinField string) (joined []byte, ok bool) {
-	eventKey, _ := js.GetUnsafeString(event, joinField)
-	cached, ok := ctx.cache[j.Name][eventKey]
+// apply the join to the event handling misses according to the join policy.
+// Returns nil if the event must not be delivered
+func (j *Join) apply(ctx *Context, event []byte) (out []byte, ok bool) {
+	if out, ok = j.Process(ctx, event); ok {
+		return out, true
+	}
+
+	switch j.Policy {
+	case JoinDrop:
+		ctx.LogDebug("dropping event without join match", "join", j.Name, "event", string(event))
+		return nil, false
+	case JoinQuarantine:
+		ctx.quarantine(event, fmt.Errorf("join %s: no match", j.Name))
+		return nil, false
+	default:
+		return appendString(event, keys.JoinMissing, j.Name), false
+	}
+}
+
+func (j *Join) join(ctx *Context, event []byte, key *Key) (joined []byte, ok bool) {
+	eventKey, err := key.Value(event)
+	if err != nil {
+		return event, false
+	}
+
+	cached, ok := ctx.cache[j.cacheName()][eventKey]
 	if ok {
 		// Include specified fields
 		for _, field := range j.IncludeFields {
@@ -43,11 +132,33 @@ func (j *Join) join(ctx *Context, event []byte, joinField string) (joined []byte
 	return event, false
 }
 
+// cacheName identifies the join data in the run cache
+func (j *Join) cacheName() (name string) {
+	if j.Node != "" {
+		return j.Name + "@" + j.Node
+	}
+	return j.Name
+}
+
 func (j *Join) loadData(ctx *Context) (err error) {
-	cache, err := getCache(ctx, j.TTL, j.Name, j.JoinOnFields)
+	var cache map[string][]byte
+
+	if j.Reference {
+		cache, err = getReference(ctx, j.Name, j.onKeys)
+	} else {
+		node := ctx.node
+		if j.Node != "" {
+			// Nodes are resolved from the configuration set in the context so credentials stay out of collectors
+			if node = ctx.nodes[j.Node]; node == nil {
+				return fmt.Errorf("cache load for %s error: node %s is not configured", j.cacheName(), j.Node)
+			}
+		}
+		cache, err = getCache(ctx, node, j)
+	}
+
 	if err != nil {
-		return fmt.Errorf("cache load for %s error: %s", j.Name, err.Error())
+		return fmt.Errorf("cache load for %s error: %s", j.cacheName(), err.Error())
 	}
-	ctx.cache[j.Name] = cache
+	ctx.cache[j.cacheName()] = cache
 	return nil
 }
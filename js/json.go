@@ -13,6 +13,21 @@ var (
 	nullValue = []byte(`null`)
 )
 
+// ValueType of a JSON value
+type ValueType = jsonparser.ValueType
+
+// JSON value types
+const (
+	NotExist = jsonparser.NotExist
+	String   = jsonparser.String
+	Number   = jsonparser.Number
+	Object   = jsonparser.Object
+	Array    = jsonparser.Array
+	Boolean  = jsonparser.Boolean
+	Null     = jsonparser.Null
+	Unknown  = jsonparser.Unknown
+)
+
 // GetValue fetches the value under the given path as an interface
 func GetValue(data []byte, path ...string) (value interface{}, err error) {
 	buf, valueType, _, err := jsonparser.Get(data, path...)
@@ -45,6 +60,12 @@ func Has(data []byte, path ...string) (exists bool) {
 	return err != jsonparser.KeyPathNotFoundError
 }
 
+// GetType returns the ValueType for the given path, NotExist if not found
+func GetType(data []byte, path ...string) (vt ValueType) {
+	_, vt, _, _ = jsonparser.Get(data, path...)
+	return vt
+}
+
 // Get the []byte for the given path
 func Get(data []byte, path ...string) (value []byte, err error) {
 	value, _, _, err = jsonparser.Get(data, path...)
@@ -161,6 +182,14 @@ func ForEach(data []byte, cb func(key string, value []byte) error, path ...strin
 	return jsonparser.ObjectEach(data, iter, path...)
 }
 
+// ForEachType is like ForEach but also passes the ValueType of each entry to the callback
+func ForEachType(data []byte, cb func(key string, value []byte, vt ValueType) error, path ...string) (err error) {
+	iter := func(key []byte, value []byte, tp jsonparser.ValueType, offset int) error {
+		return cb(*(*string)(unsafe.Pointer(&key)), value, tp)
+	}
+	return jsonparser.ObjectEach(data, iter, path...)
+}
+
 // // ArrayEach is used when iterating arrays, accepts a callback function with the same return arguments as `Get`.
 // func (j *JSON) ArrayEach(cb func(value []byte, err error), path ...string) (err error) {
 // 	iter := func(value []byte, tp jsonparser.ValueType, offset int, err error) {
@@ -0,0 +1,62 @@
+package tact
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brunotm/tact/js"
+)
+
+const (
+	// DefaultKeySeparator is used to join composite key values when no separator is specified
+	DefaultKeySeparator = ":"
+)
+
+// Key is an ordered list of fields composing an event key
+type Key struct {
+	Fields    []string // Fields composing the key, in order
+	Separator string   // Separator between field values, defaults to DefaultKeySeparator
+}
+
+// NewKey creates a Key from the given fields joined by sep
+func NewKey(sep string, fields ...string) (key *Key) {
+	return &Key{Fields: fields, Separator: sep}
+}
+
+// Value returns the key value for the given event. All key fields must be present
+func (k *Key) Value(event []byte) (value string, err error) {
+	if len(k.Fields) == 1 {
+		return js.GetUnsafeString(event, k.Fields[0])
+	}
+
+	values := make([]string, len(k.Fields))
+	for i := range k.Fields {
+		if values[i], err = js.GetUnsafeString(event, k.Fields[i]); err != nil {
+			return "", fmt.Errorf("key field %s: %s", k.Fields[i], err)
+		}
+	}
+
+	sep := k.Separator
+	if sep == "" {
+		sep = DefaultKeySeparator
+	}
+	return strings.Join(values, sep), nil
+}
+
+// String returns the key description
+func (k *Key) String() string {
+	return strings.Join(k.Fields, "+")
+}
+
+// validate the key definition
+func (k *Key) validate() (err error) {
+	if len(k.Fields) == 0 {
+		return fmt.Errorf("key with no fields")
+	}
+	for _, field := range k.Fields {
+		if field == "" {
+			return fmt.Errorf("key with empty field name")
+		}
+	}
+	return nil
+}
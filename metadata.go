@@ -0,0 +1,141 @@
+package tact
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brunotm/tact/log"
+)
+
+const (
+	// DefaultSchedule is the default cron like schedule of collectors not defining one
+	DefaultSchedule = "0 */1 * * * *"
+	// DefaultTimeout is the default run timeout of collectors not defining one
+	DefaultTimeout = 290 * time.Second
+)
+
+// Category of the data provided by a collector
+type Category string
+
+// Collector categories
+const (
+	CategoryConfig      Category = "config"      // Configuration and inventory data
+	CategoryPerformance Category = "performance" // Performance and utilization metrics
+	CategoryLog         Category = "log"         // Log messages
+)
+
+// Supported node platforms
+const (
+	PlatformLinux = "linux"
+	PlatformAIX   = "aix"
+)
+
+// Credential is a kind of node credential required by a collector
+type Credential string
+
+// Node credentials
+const (
+	CredentialSSH Credential = "ssh" // SSH user with password or key
+	CredentialDB  Credential = "db"  // Database user and password
+	CredentialAPI Credential = "api" // API URL
+)
+
+// initMetadata validates the collector metadata and fills the defaults.
+// The category is taken from the collector name, eg. /linux/config/lsblk, when not given
+func (c *Collector) initMetadata() (err error) {
+	if c.Category == "" {
+		if path := strings.Split(c.Name, "/"); len(path) > 2 {
+			switch category := Category(path[2]); category {
+			case CategoryConfig, CategoryPerformance, CategoryLog:
+				c.Category = category
+			}
+		}
+	}
+
+	switch c.Category {
+	case "", CategoryConfig, CategoryPerformance, CategoryLog:
+	default:
+		return fmt.Errorf("invalid category %q", c.Category)
+	}
+
+	for _, credential := range c.Credentials {
+		switch credential {
+		case CredentialSSH, CredentialDB, CredentialAPI:
+		default:
+			return fmt.Errorf("invalid credential %q", credential)
+		}
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s", c.Timeout)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Schedule == "" {
+		c.Schedule = DefaultSchedule
+	}
+	return nil
+}
+
+// Supports returns whether the collector supports the node platform.
+// Collectors without platforms and nodes without a type are always supported
+func (c *Collector) Supports(node *Node) (ok bool) {
+	if len(c.Platforms) == 0 || node.Type == "" {
+		return true
+	}
+	for _, platform := range c.Platforms {
+		if strings.EqualFold(platform, node.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingCredentials returns the credentials required by the collector not configured in the node
+func (c *Collector) MissingCredentials(node *Node) (missing []Credential) {
+	for _, credential := range c.Credentials {
+		var ok bool
+		switch credential {
+		case CredentialSSH:
+			ok = node.SSHUser != "" && (node.SSHPassword != "" || len(node.SSHKey) > 0)
+		case CredentialDB:
+			ok = node.DBUser != "" && node.DBPassword != ""
+		case CredentialAPI:
+			ok = node.APIURL != ""
+		}
+		if !ok {
+			missing = append(missing, credential)
+		}
+	}
+	return missing
+}
+
+// CheckNode returns an error if the collector can not run on the given node
+func (c *Collector) CheckNode(node *Node) (err error) {
+	if !c.Supports(node) {
+		return fmt.Errorf("collector %s does not support node %s of type %s", c.Name, node.HostName, node.Type)
+	}
+	if missing := c.MissingCredentials(node); len(missing) > 0 {
+		names := make([]string, len(missing))
+		for i := range missing {
+			names[i] = string(missing[i])
+		}
+		return fmt.Errorf("collector %s requires %s credentials for node %s",
+			c.Name, strings.Join(names, ", "), node.HostName)
+	}
+	return nil
+}
+
+// Applicable returns the collectors that can run on the node, logging the skipped ones
+func Applicable(collectors []*Collector, node *Node) (applicable []*Collector) {
+	for _, c := range collectors {
+		if err := c.CheckNode(node); err != nil {
+			log.Info("skipping collector", "collector", c.Name, "node", node.HostName, "reason", err.Error())
+			continue
+		}
+		applicable = append(applicable, c)
+	}
+	return applicable
+}
@@ -0,0 +1,187 @@
+package tact
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/brunotm/tact/js"
+)
+
+// ErrorPolicy defines how a failing post op is handled
+type ErrorPolicy int
+
+// Post op error policies
+const (
+	OnErrorDrop     ErrorPolicy = iota // Log the error and drop the event
+	OnErrorKeep                        // Log the error and continue the chain with the event as before the op
+	OnErrorAnnotate                    // Continue the chain with the event as before the op, annotated with the error
+)
+
+// PostOpBuilder builds a post processing function whose definition must be validated at registration
+type PostOpBuilder func() (fn PostEventOpsFn, err error)
+
+// PostOp is a post processing step applied to the events after the event ops
+type PostOp struct {
+	Name    string         // Name for logging and error annotations
+	Fn      PostEventOpsFn // The post processing function
+	Build   PostOpBuilder  // Builds Fn at registration instead, eg. RegexExtract
+	OnError ErrorPolicy    // How to handle errors returned by Fn
+}
+
+// init validates the post op definition, building its function if needed
+func (p *PostOp) init() (err error) {
+	if p.Build != nil {
+		if p.Fn != nil {
+			return fmt.Errorf("post op %s: both function and builder given", p.Name)
+		}
+		if p.Fn, err = p.Build(); err != nil {
+			return fmt.Errorf("post op %s: %s", p.Name, err)
+		}
+	}
+
+	if p.Fn == nil {
+		return fmt.Errorf("post op %s: null function", p.Name)
+	}
+
+	switch p.OnError {
+	case OnErrorDrop, OnErrorKeep, OnErrorAnnotate:
+	default:
+		return fmt.Errorf("post op %s: invalid error policy %d", p.Name, p.OnError)
+	}
+	return nil
+}
+
+// postProcess applies the post ops chain in order. Returns nil if the event must be dropped
+func (c *Collector) postProcess(ctx *Context, event []byte) (out []byte) {
+	for _, op := range c.PostOps {
+		in := event
+		if op.OnError != OnErrorDrop {
+			// Keep the original event intact in case the op fails midway
+			in = append([]byte(nil), event...)
+		}
+
+		newEvent, err := op.Fn(in)
+		if err == nil {
+			event = newEvent
+			continue
+		}
+
+		switch op.OnError {
+		case OnErrorKeep:
+			ctx.LogWarn("post op error, keeping event", "op", op.Name, "error", err, "event", string(event))
+		case OnErrorAnnotate:
+			event = annotateError(event, fmt.Errorf("%s: %s", op.Name, err))
+		default:
+			ctx.LogError("post op error, dropping event", "op", op.Name, "error", err, "event", string(event))
+			return nil
+		}
+	}
+	return event
+}
+
+// SumFields returns a post op function setting the field to with the sum of the given fields
+func SumFields(to string, fields ...string) PostEventOpsFn {
+	return func(event []byte) (out []byte, err error) {
+		var total float64
+		for _, field := range fields {
+			value, err := js.GetFloat(event, field)
+			if err != nil {
+				return nil, fmt.Errorf("sum %s: field %s: %s", to, field, err)
+			}
+			total += value
+		}
+		return js.Set(event, total, to)
+	}
+}
+
+// CopyField returns a post op function copying the value of the field from to the field to
+func CopyField(from, to string) PostEventOpsFn {
+	return func(event []byte) (out []byte, err error) {
+		value, err := js.Get(event, from)
+		if err != nil {
+			return nil, fmt.Errorf("copy %s: %s", from, err)
+		}
+
+		// js.Get strips the quotes from strings
+		if js.GetType(event, from) == js.String {
+			value = append(append([]byte{'"'}, value...), '"')
+		} else {
+			value = append([]byte(nil), value...)
+		}
+		return js.SetRawBytes(event, value, to)
+	}
+}
+
+// ParseTime returns a post op function parsing the field with the given layout and setting it as a RFC3339 timestamp.
+// When the layout has no year, as in syslog timestamps, the current year is assumed,
+// or the previous one if that would place the timestamp more than a day in the future
+func ParseTime(field, layout string) PostEventOpsFn {
+	return func(event []byte) (out []byte, err error) {
+		value, err := js.GetString(event, field)
+		if err != nil {
+			return nil, fmt.Errorf("parse time %s: %s", field, err)
+		}
+
+		ts, err := time.Parse(layout, value)
+		if err != nil {
+			return nil, fmt.Errorf("parse time %s: %s", field, err)
+		}
+
+		// time.Parse leaves the year as zero when the layout has none
+		if ts.Year() == 0 {
+			now := time.Now()
+			ts = ts.AddDate(now.Year()-ts.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+		}
+		return js.Set(event, ts, field)
+	}
+}
+
+// RegexExtract returns a post op builder for a function matching the field against the regular expression
+// and setting the named capture groups as string fields. The expression is compiled at registration and
+// must have named groups. Events not matching the expression are an error
+func RegexExtract(field, expr string) PostOpBuilder {
+	return func() (fn PostEventOpsFn, err error) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("regex extract %s: %s", field, err)
+		}
+
+		var named bool
+		for _, name := range re.SubexpNames() {
+			named = named || name != ""
+		}
+		if !named {
+			return nil, fmt.Errorf("regex extract %s: expression without named groups: %s", field, expr)
+		}
+		return regexExtract(field, re), nil
+	}
+}
+
+// regexExtract returns the post op function for RegexExtract
+func regexExtract(field string, re *regexp.Regexp) PostEventOpsFn {
+	return func(event []byte) (out []byte, err error) {
+		value, err := js.GetString(event, field)
+		if err != nil {
+			return nil, fmt.Errorf("regex extract %s: %s", field, err)
+		}
+
+		match := re.FindStringSubmatch(value)
+		if match == nil {
+			return nil, fmt.Errorf("regex extract %s: no match for %q", field, value)
+		}
+
+		for i, name := range re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			if event, err = js.Set(event, match[i], name); err != nil {
+				return nil, err
+			}
+		}
+		return event, nil
+	}
+}
@@ -0,0 +1,178 @@
+package tact
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/brunotm/tact/js"
+	"github.com/brunotm/tact/proto"
+	"github.com/brunotm/tact/storage"
+)
+
+var (
+	referencePrefix = []byte(`reference/`)
+)
+
+// Reference table formats
+const (
+	ReferenceCSV  = "csv"  // Header row with the field names followed by the records, values are strings
+	ReferenceJSON = "json" // Array of objects or newline delimited objects
+)
+
+// ImportReference stores a reference table for joins from the given reader,
+// replacing any previous table with the same name. Returns the number of imported records
+func ImportReference(name, format string, r io.Reader) (n int, err error) {
+	if name == "" {
+		return 0, fmt.Errorf("reference: empty table name")
+	}
+
+	var records [][]byte
+	switch format {
+	case ReferenceCSV:
+		records, err = readCSVReference(r)
+	case ReferenceJSON:
+		records, err = readJSONReference(r)
+	default:
+		return 0, fmt.Errorf("reference: invalid format %q", format)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("reference %s: %s", name, err)
+	}
+
+	data, err := (&proto.Cache{Data: records}).Marshal()
+	if err != nil {
+		return 0, err
+	}
+
+	txn := Store.NewTxn(true)
+	defer txn.Discard()
+
+	if err = txn.Set(append(referencePrefix, name...), data); err != nil {
+		return 0, err
+	}
+	return len(records), txn.Commit()
+}
+
+// DeleteReference removes the given reference table
+func DeleteReference(name string) (err error) {
+	txn := Store.NewTxn(true)
+	defer txn.Discard()
+
+	if err = txn.Delete(append(referencePrefix, name...)); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// getReference returns the reference table indexed by the given keys.
+// It is read in its own read only transaction so imports do not make the session commit conflict
+func getReference(ctx *Context, name string, keys []*Key) (cache map[string][]byte, err error) {
+	txn := ctx.store.NewTxn(false)
+	defer txn.Discard()
+
+	data, err := txn.Get(append(referencePrefix, name...))
+	if err == storage.ErrKeyNotFound {
+		return nil, fmt.Errorf("reference table %s not imported", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &proto.Cache{}
+	if err = table.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return indexCache(ctx, table.Data, keys), nil
+}
+
+// readCSVReference reads the records with the field names from the header row
+func readCSVReference(r io.Reader) (records [][]byte, err error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %s", err)
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := []byte(`{}`)
+		for i := range header {
+			if record, err = js.Set(record, row[i], header[i]); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+// readJSONReference reads an array of objects or newline delimited objects
+func readJSONReference(r io.Reader) (records [][]byte, err error) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return nil, fmt.Errorf("empty table")
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			continue
+		}
+		br.UnreadRune()
+		break
+	}
+
+	decoder := json.NewDecoder(br)
+	first, _ := br.Peek(1)
+
+	if first[0] == '[' {
+		var objects []json.RawMessage
+		if err = decoder.Decode(&objects); err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if records, err = appendObject(records, object); err != nil {
+				return nil, err
+			}
+		}
+		return records, nil
+	}
+
+	for {
+		var object json.RawMessage
+		if err = decoder.Decode(&object); err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if records, err = appendObject(records, object); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// appendObject appends the compacted JSON object to the records
+func appendObject(records [][]byte, object json.RawMessage) (out [][]byte, err error) {
+	if js.GetType(object) != js.Object {
+		return nil, fmt.Errorf("record %d is not an object", len(records)+1)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = json.Compact(buf, object); err != nil {
+		return nil, err
+	}
+	return append(records, buf.Bytes()), nil
+}
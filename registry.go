@@ -1,11 +1,45 @@
 package tact
 
 import (
-	"fmt"
+	"errors"
+	"sort"
 	"strings"
 	"sync"
 )
 
+// Registry errors, wrapped in a RegistryError
+var (
+	ErrInvalidCollector   = errors.New("invalid collector")
+	ErrCollectorExists    = errors.New("collector already exists")
+	ErrCollectorNotFound  = errors.New("collector does not exist")
+	ErrGroupNotFound      = errors.New("collector group does not exist")
+	ErrDependencyCycle    = errors.New("dependency cycle")
+	ErrCollectorHasJoiner = errors.New("collector joined by other collectors")
+)
+
+// RegistryError describes a failed registry operation
+type RegistryError struct {
+	Name   string // Collector or group name
+	Err    error  // One of the registry errors
+	Reason string // Details, if any
+}
+
+func (e *RegistryError) Error() string {
+	msg := "registry: " + e.Err.Error()
+	if e.Name != "" {
+		msg += ": " + e.Name
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Unwrap returns the registry error, for use with errors.Is
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
 // registry container for Collectors
 type registry struct {
 	mtx        *sync.RWMutex
@@ -13,51 +47,237 @@ type registry struct {
 	groups     map[string][]*Collector
 }
 
-// Add a Collector path type.collector to the registry
+// Add a Collector path type.collector to the registry, panicking if it can not be registered.
+// Meant for registration from package init functions
 func (r *registry) Add(collector *Collector) {
+	if err := r.Register(collector); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Register validates and adds a Collector to the registry
+func (r *registry) Register(collector *Collector) (err error) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
 	if collector.Name == "" {
-		panic("registry: added collector with empty name")
+		return &RegistryError{Err: ErrInvalidCollector, Reason: "empty name"}
 	}
 	if collector.GetData == nil {
-		panic("registry: added collector with null collector function")
+		return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: "null collector function"}
 	}
 
 	if _, ok := r.collectors[collector.Name]; ok {
-		panic(fmt.Sprintf("registry: collector already exists: %s", collector.Name))
+		return &RegistryError{Name: collector.Name, Err: ErrCollectorExists}
+	}
+
+	if err = collector.initMetadata(); err != nil {
+		return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+	}
+
+	if collector.EventOps != nil {
+		if err = collector.EventOps.init(); err != nil {
+			return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+		}
+	}
+
+	for _, op := range collector.PostOps {
+		if err = op.init(); err != nil {
+			return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+		}
 	}
+
+	for _, join := range collector.Joins {
+		if err = join.init(); err != nil {
+			return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+		}
+	}
+
+	if collector.EventOps != nil {
+		if err = collector.EventOps.checkRenames(collector); err != nil {
+			return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+		}
+	}
+
+	if collector.Filter != nil {
+		if err = collector.Filter.Compile(); err != nil {
+			return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+		}
+	}
+
+	if collector.Schema != nil {
+		if err = collector.Schema.init(); err != nil {
+			return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+		}
+		if collector.EventOps != nil {
+			if err = collector.Schema.recordUnits(collector.EventOps); err != nil {
+				return &RegistryError{Name: collector.Name, Err: ErrInvalidCollector, Reason: err.Error()}
+			}
+		}
+	}
+
+	if cycle := r.cycleLocked(collector); cycle != nil {
+		return &RegistryError{Name: collector.Name, Err: ErrDependencyCycle, Reason: strings.Join(cycle, " -> ")}
+	}
+
 	r.collectors[collector.Name] = collector
 
-	path := strings.Split(collector.Name, "/")
-	group := strings.Join(path[:len(path)-1], "/")
+	group := groupName(collector.Name)
 	r.groups[group] = append(r.groups[group], collector)
+	return nil
+}
+
+// Unregister removes the Collector with the given name from the registry.
+// Collectors joined by other registered collectors can not be removed
+func (r *registry) Unregister(name string) (err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.collectors[name]; !ok {
+		return &RegistryError{Name: name, Err: ErrCollectorNotFound}
+	}
+
+	var joiners []string
+	for _, collector := range r.collectors {
+		for _, dep := range dependencies(collector) {
+			if dep == name && collector.Name != name {
+				joiners = append(joiners, collector.Name)
+			}
+		}
+	}
+	if len(joiners) > 0 {
+		sort.Strings(joiners)
+		return &RegistryError{Name: name, Err: ErrCollectorHasJoiner, Reason: strings.Join(joiners, ", ")}
+	}
+
+	delete(r.collectors, name)
 
+	group := groupName(name)
+	collectors := r.groups[group][:0]
+	for _, collector := range r.groups[group] {
+		if collector.Name != name {
+			collectors = append(collectors, collector)
+		}
+	}
+
+	if len(collectors) == 0 {
+		delete(r.groups, group)
+	} else {
+		r.groups[group] = collectors
+	}
+	return nil
 }
 
-// Get fetches the Collector for the given name
+// Get fetches the Collector for the given name, panicking if it does not exist
 func (r *registry) Get(name string) (collector *Collector) {
+	collector, err := r.Lookup(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return collector
+}
+
+// Lookup fetches the Collector for the given name
+func (r *registry) Lookup(name string) (collector *Collector, err error) {
+	collector, ok := r.lookup(name)
+	if !ok {
+		return nil, &RegistryError{Name: name, Err: ErrCollectorNotFound}
+	}
+	return collector, nil
+}
+
+// lookup fetches the Collector for the given name without panicking
+func (r *registry) lookup(name string) (collector *Collector, ok bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	collector, ok = r.collectors[name]
+	return collector, ok
+}
+
+// GetGroup fetches the Collectors for the given group, panicking if it does not exist
+func (r *registry) GetGroup(name string) (collectors []*Collector) {
+	collectors, err := r.LookupGroup(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return collectors
+}
+
+// LookupGroup fetches the Collectors for the given group, eg. /linux/performance
+func (r *registry) LookupGroup(name string) (collectors []*Collector, err error) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 
-	collector, ok := r.collectors[name]
-	if ok {
-		return collector
+	group, ok := r.groups[name]
+	if !ok {
+		return nil, &RegistryError{Name: name, Err: ErrGroupNotFound}
 	}
 
-	panic(fmt.Sprintf("registry: collector %s does not exist", name))
+	collectors = make([]*Collector, len(group))
+	copy(collectors, group)
+	return collectors, nil
 }
 
-// GetGroup fetches the Collector for the given name
-func (r *registry) GetGroup(name string) (collectors []*Collector) {
+// List returns all the registered Collectors sorted by name
+func (r *registry) List() (collectors []*Collector) {
+	return r.find(func(*Collector) bool { return true })
+}
+
+// Search returns the Collectors with names starting with the given prefix sorted by name, eg. /linux
+func (r *registry) Search(prefix string) (collectors []*Collector) {
+	return r.find(func(c *Collector) bool { return strings.HasPrefix(c.Name, prefix) })
+}
+
+// ListTag returns the Collectors with the given tag sorted by name
+func (r *registry) ListTag(tag string) (collectors []*Collector) {
+	return r.find(func(c *Collector) bool {
+		for _, t := range c.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// ListCategory returns the Collectors of the given category sorted by name
+func (r *registry) ListCategory(category Category) (collectors []*Collector) {
+	return r.find(func(c *Collector) bool { return c.Category == category })
+}
+
+// ListPlatform returns the Collectors supporting the given node type sorted by name
+func (r *registry) ListPlatform(platform string) (collectors []*Collector) {
+	return r.find(func(c *Collector) bool { return c.Supports(&Node{Type: platform}) })
+}
+
+// Groups returns the names of the collector groups
+func (r *registry) Groups() (groups []string) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 
-	collectors, ok := r.groups[name]
-	if ok {
-		return collectors
+	for group := range r.groups {
+		groups = append(groups, group)
 	}
+	sort.Strings(groups)
+	return groups
+}
+
+// find returns the Collectors matching the given function sorted by name
+func (r *registry) find(match func(*Collector) bool) (collectors []*Collector) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, name := range r.namesLocked() {
+		if collector := r.collectors[name]; match(collector) {
+			collectors = append(collectors, collector)
+		}
+	}
+	return collectors
+}
 
-	panic(fmt.Sprintf("registry: collector group %s does not exist", name))
+// groupName returns the group of the given collector name
+func groupName(name string) (group string) {
+	path := strings.Split(name, "/")
+	return strings.Join(path[:len(path)-1], "/")
 }
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,16 +13,23 @@ import (
 	"github.com/robfig/cron"
 )
 
+const (
+	acquireInterval = 250 * time.Millisecond // Interval to check for cancellation when acquiring a run slot
+	cancelTimeout   = 10 * time.Second       // How long cancelled jobs are waited for to return
+)
+
 // Scheduler type
 type Scheduler struct {
-	mtx     sync.Mutex
-	ctx     context.Context          // Main context that will be propagated to running collectors
-	cancel  context.CancelFunc       // Cancel function of main context
-	grace   time.Duration            // Grace period before failing a start when acquiring a run slot
-	sema    sema.Sema                // Semaphore to control maxTasks run slots
-	cron    *cron.Cron               // The cron scheduler
-	running map[string]*tact.Context // The store for current running ctxs
-	wchan   chan []byte
+	mtx      sync.Mutex
+	ctx      context.Context          // Main context that will be propagated to running collectors
+	cancel   context.CancelFunc       // Cancel function of main context
+	grace    time.Duration            // Grace period before failing a start when acquiring a run slot
+	sema     sema.Sema                // Semaphore to control maxTasks run slots
+	cron     *cron.Cron               // The cron scheduler
+	running  map[string]*tact.Context // The store for current running ctxs
+	jobs     sync.WaitGroup           // Tracks started jobs for shutdown
+	stopping bool                     // Whether the scheduler is shutting down
+	wchan    chan []byte
 }
 
 // New returns a initialized scheduler
@@ -45,11 +53,98 @@ func New(maxTasks int, grace time.Duration, wchan chan []byte) (sched *Scheduler
 	}
 }
 
-// AddJob function
-func (s *Scheduler) AddJob(spec string, coll *tact.Collector, node *tact.Node, ttl time.Duration) (err error) {
+// JobOpt configures a scheduled job
+type JobOpt func(j *job) (err error)
+
+// job holds the per job configuration
+type job struct {
+	filter   *tact.Filter
+	fieldMap *tact.FieldMap
+	nodes    map[string]*tact.Node
+}
+
+// WithFilter narrows the events and fields delivered by the job collector
+func WithFilter(filter *tact.Filter) JobOpt {
+	return func(j *job) (err error) {
+		if err = filter.Compile(); err != nil {
+			return err
+		}
+		j.filter = filter
+		return nil
+	}
+}
+
+// WithFieldMap renames and deletes the fields delivered by the job collector
+func WithFieldMap(fieldMap *tact.FieldMap) JobOpt {
+	return func(j *job) (err error) {
+		if err = fieldMap.Compile(); err != nil {
+			return err
+		}
+		j.fieldMap = fieldMap
+		return nil
+	}
+}
+
+// WithNodes configures the nodes, by host name, that the job collector joins can run their collectors on
+func WithNodes(nodes ...*tact.Node) JobOpt {
+	return func(j *job) (err error) {
+		j.nodes = make(map[string]*tact.Node, len(nodes))
+		for _, node := range nodes {
+			if node.HostName == "" {
+				return fmt.Errorf("join node without host name")
+			}
+			if _, ok := j.nodes[node.HostName]; ok {
+				return fmt.Errorf("duplicate join node %s", node.HostName)
+			}
+			j.nodes[node.HostName] = node
+		}
+		return nil
+	}
+}
+
+// AddJob schedules the collector on the node. The collector default schedule and timeout
+// are used when spec is empty and ttl is zero
+func (s *Scheduler) AddJob(spec string, coll *tact.Collector, node *tact.Node, ttl time.Duration, opts ...JobOpt) (err error) {
 	jobname := fmt.Sprintf("%s/%s", coll.Name, node.HostName)
 
+	if err = coll.CheckNode(node); err != nil {
+		return fmt.Errorf("scheduler: job %s: %s", jobname, err)
+	}
+
+	if spec == "" {
+		spec = coll.Schedule
+	}
+	if ttl == 0 {
+		ttl = coll.Timeout
+	}
+
+	j := &job{}
+	for _, opt := range opts {
+		if err = opt(j); err != nil {
+			return fmt.Errorf("scheduler: job %s: %s", jobname, err)
+		}
+	}
+
+	for _, join := range coll.Joins {
+		if _, ok := j.nodes[join.Node]; join.Node != "" && !ok {
+			return fmt.Errorf("scheduler: job %s: join %s node %s is not configured", jobname, join.Name, join.Node)
+		}
+	}
+
 	fn := func() {
+		if !s.startJob() {
+			log.Warn("scheduler: shutting down, skipping run",
+				"collector", coll.Name, "node", node.HostName)
+			return
+		}
+		defer s.jobs.Done()
+
+		if !s.acquire() {
+			log.Error("scheduler: Timeout waiting for slot", "collector", coll.Name, "node", node.HostName)
+			return
+		}
+		defer s.sema.Release()
+
 		ctx, err := tact.NewContext(s.ctx, coll.Name, node, tact.Store, ttl)
 		if err != nil {
 			log.Error(
@@ -57,15 +152,20 @@ func (s *Scheduler) AddJob(spec string, coll *tact.Collector, node *tact.Node, t
 				"collector", coll.Name, "node", node.HostName, "error", err.Error())
 			return
 		}
-		if !s.sema.AcquireWithin(s.grace) {
-			ctx.LogError("scheduler: Timeout waiting for slot")
-			return
+		if j.filter != nil {
+			ctx.SetFilter(j.filter)
+		}
+		if j.fieldMap != nil {
+			ctx.SetFieldMap(j.fieldMap)
+		}
+		if j.nodes != nil {
+			ctx.SetNodes(j.nodes)
 		}
-		defer s.sema.Release()
 		ctx.LogDebug("aquired scheduler run slot")
 
 		if !s.addRun(jobname, ctx) {
 			ctx.LogError("scheduler: Already running")
+			ctx.Cancel()
 			return
 		}
 
@@ -75,46 +175,128 @@ func (s *Scheduler) AddJob(spec string, coll *tact.Collector, node *tact.Node, t
 			ctx.LogError("scheduler: Not found for removal after completion")
 		}
 	}
-	log.Info("schedule: add job", "collector", coll.Name, "node", node.HostName, "schedule", spec)
+	log.Info("schedule: add job", "collector", coll.Name, "node", node.HostName,
+		"schedule", spec, "timeout_seconds", ttl.Seconds())
 	return s.cron.AddFunc(spec, fn)
 }
 
+// AddJobs schedules the collectors that can run on the node, skipping the ones not supporting
+// its type or missing their credentials, as when scheduling a collector group
+func (s *Scheduler) AddJobs(spec string, colls []*tact.Collector, node *tact.Node, ttl time.Duration, opts ...JobOpt) (err error) {
+	for _, coll := range tact.Applicable(colls, node) {
+		if err = s.AddJob(spec, coll, node, ttl, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Start the scheduler
 func (s *Scheduler) Start() {
 	s.cron.Start()
 }
 
-// Stop the scheduler and wait for runnning jobs to finish
-func (s *Scheduler) Stop() {
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
+// Stop the scheduler in order: stop scheduling new runs, wait up to timeout for
+// running jobs to finish and cancel the remaining ones, discarding their pending data.
+// The names of the cancelled jobs are returned. Cancelled jobs are waited for a few seconds,
+// only when no error is returned all jobs have returned and it is safe to close the write channel
+// and the Store afterwards.
+func (s *Scheduler) Stop(timeout time.Duration) (abandoned []string, err error) {
+	s.shutdown()
 
-	s.cron.Stop()
-	s.waitJobs()
+	if !s.waitJobs(timeout) {
+		abandoned = s.runningJobs()
+		for _, name := range abandoned {
+			log.Warn("scheduler: cancelling job after shutdown timeout",
+				"job", name, "timeout_seconds", timeout.Seconds())
+		}
+	}
+
+	return abandoned, s.cancelJobs()
+}
+
+// Cancel the scheduler and runnning jobs, waiting a few seconds for them to return.
+// An error is returned if jobs are still running
+func (s *Scheduler) Cancel() (err error) {
+	s.shutdown()
+	return s.cancelJobs()
+}
+
+// cancelJobs cancels the running jobs and waits for them to return
+func (s *Scheduler) cancelJobs() (err error) {
 	s.cancel()
+	if !s.waitJobs(cancelTimeout) {
+		return fmt.Errorf("scheduler: jobs still running after cancellation: %s",
+			strings.Join(s.runningJobs(), ", "))
+	}
+	return nil
+}
 
+// shutdown stops the cron scheduler and prevents new jobs from starting
+func (s *Scheduler) shutdown() {
+	s.mtx.Lock()
+	s.stopping = true
+	s.mtx.Unlock()
+	s.cron.Stop()
 }
 
-// Cancel the scheduler and runnning jobs
-func (s *Scheduler) Cancel() {
+// startJob registers a starting job unless the scheduler is shutting down
+func (s *Scheduler) startJob() (ok bool) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	s.cron.Stop()
-	s.cancel()
-	s.waitJobs()
+	if s.stopping {
+		return false
+	}
+	s.jobs.Add(1)
+	return true
 }
 
-func (s *Scheduler) waitJobs() {
-	cancel := time.After(15 * time.Second)
-	for s.sema.Holders() > 0 {
-		select {
-		case <-cancel:
-			return
-		case <-time.After(time.Second * 1):
-			continue
+// acquire a run slot within the grace period, giving up if the scheduler is cancelled
+func (s *Scheduler) acquire() (ok bool) {
+	deadline := time.Now().Add(s.grace)
+	for s.ctx.Err() == nil {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false
 		}
+		if wait > acquireInterval {
+			wait = acquireInterval
+		}
+		if s.sema.AcquireWithin(wait) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitJobs waits for started jobs to finish within the given timeout
+func (s *Scheduler) waitJobs(timeout time.Duration) (ok bool) {
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (s *Scheduler) runningJobs() (names []string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for name := range s.running {
+		names = append(names, name)
 	}
+	return names
 }
 
 func (s *Scheduler) addRun(name string, ctx *tact.Context) (ok bool) {
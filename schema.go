@@ -0,0 +1,338 @@
+package tact
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brunotm/tact/collector/keys"
+	"github.com/brunotm/tact/js"
+)
+
+// FieldType is the expected type of an event field
+type FieldType string
+
+// Field types
+const (
+	FieldNumber FieldType = "number"
+	FieldString FieldType = "string"
+	FieldBool   FieldType = "bool"
+	FieldTime   FieldType = "time"
+)
+
+// FieldKind tells whether a field identifies or measures the collected entity
+type FieldKind string
+
+// Field kinds
+const (
+	Label  FieldKind = "label"  // Dimension identifying the entity, eg. device name
+	Metric FieldKind = "metric" // Measurement value
+)
+
+// InvalidPolicy defines how events failing schema validation are handled
+type InvalidPolicy int
+
+// Invalid event policies
+const (
+	InvalidLog        InvalidPolicy = iota // Log the validation error and deliver the event
+	InvalidDrop                            // Log the validation error and drop the event
+	InvalidTag                             // Deliver the event annotated with the validation errors
+	InvalidQuarantine                      // Route the event annotated with the validation errors to the Quarantine sink
+)
+
+// Field describes an event field
+type Field struct {
+	Name        string    // Field name
+	Type        FieldType // Expected value type
+	Kind        FieldKind // Label or metric
+	Unit        Unit      // Unit of the value, if any
+	Description string    // Human readable description
+	Required    bool      // Whether the field must be present and not null
+}
+
+// Schema declares the fields emitted by a collector
+type Schema struct {
+	Strict  bool          // Unknown fields are invalid
+	Invalid InvalidPolicy // How to handle invalid events
+	Fields  []*Field      // Field definitions
+	index   map[string]*Field
+}
+
+// baseFields are set on every event by the collector context
+var baseFields = []*Field{
+	{Name: keys.Time, Type: FieldTime, Kind: Label, Required: true, Description: "Event timestamp"},
+	{Name: keys.Metric, Type: FieldString, Kind: Label, Required: true, Description: "Collector name"},
+	{Name: keys.Host, Type: FieldString, Kind: Label, Required: true, Description: "Node host name"},
+}
+
+// reservedFields are annotations that can be set on any event
+var reservedFields = map[string]struct{}{
+	keys.Errors:       {},
+	keys.CounterReset: {},
+	keys.CounterWrap:  {},
+	keys.JoinMissing:  {},
+}
+
+// init validates the schema definitions and builds the field index
+func (s *Schema) init() (err error) {
+	s.index = make(map[string]*Field, len(s.Fields))
+	for _, field := range s.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("schema: field with empty name")
+		}
+
+		switch field.Type {
+		case FieldNumber, FieldString, FieldBool, FieldTime:
+		default:
+			return fmt.Errorf("schema: invalid type %q for field %s", field.Type, field.Name)
+		}
+
+		switch field.Kind {
+		case Label, Metric:
+		case "":
+			field.Kind = Metric
+			if field.Type != FieldNumber {
+				field.Kind = Label
+			}
+		default:
+			return fmt.Errorf("schema: invalid kind %q for field %s", field.Kind, field.Name)
+		}
+
+		if _, ok := s.index[field.Name]; ok {
+			return fmt.Errorf("schema: duplicate field %s", field.Name)
+		}
+		s.index[field.Name] = field
+	}
+
+	switch s.Invalid {
+	case InvalidLog, InvalidDrop, InvalidTag, InvalidQuarantine:
+	default:
+		return fmt.Errorf("schema: invalid policy %d", s.Invalid)
+	}
+	return nil
+}
+
+// validate the event applying the invalid event policy.
+// Returns nil if the event must not be delivered
+func (s *Schema) validate(ctx *Context, event []byte) (out []byte) {
+	err := s.Validate(event)
+	if err == nil {
+		return event
+	}
+
+	switch s.Invalid {
+	case InvalidDrop:
+		ctx.LogError("dropping invalid event", "error", err.Error(), "event", string(event))
+		return nil
+	case InvalidTag:
+		return annotateError(event, err)
+	case InvalidQuarantine:
+		ctx.quarantine(event, err)
+		return nil
+	default:
+		ctx.LogWarn("invalid event", "error", err.Error(), "event", string(event))
+		return event
+	}
+}
+
+// recordUnits sets the units of fields converted by the given event ops
+func (s *Schema) recordUnits(eo *EventOps) (err error) {
+	for name := range eo.Units {
+		unit := eo.fieldUnit(name)
+		if renamed, ok := eo.FieldRenames[name]; ok {
+			name = renamed
+		}
+
+		field, ok := s.index[name]
+		if !ok {
+			continue
+		}
+
+		switch field.Unit {
+		case "":
+			field.Unit = unit
+		case unit:
+		default:
+			return fmt.Errorf("schema: field %s declared as %s but converted to %s", name, field.Unit, unit)
+		}
+	}
+	return nil
+}
+
+// Field returns the definition for the given field name
+func (s *Schema) Field(name string) (field *Field, ok bool) {
+	field, ok = s.index[name]
+	return field, ok
+}
+
+// ValidationError holds the schema violations found in an event
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "schema: " + strings.Join(e.Errors, "; ")
+}
+
+// Validate the given event against this schema.
+// Fields set by the collector context (time, _metric, host) and annotations are always allowed
+func (s *Schema) Validate(event []byte) (err error) {
+	verr := &ValidationError{}
+
+	err = js.ForEachType(event, func(key string, value []byte, vt js.ValueType) error {
+		field, ok := s.index[key]
+		if !ok {
+			if _, ok := reservedFields[key]; ok {
+				return nil
+			}
+			for _, base := range baseFields {
+				if base.Name == key {
+					return nil
+				}
+			}
+			if s.Strict {
+				verr.Errors = append(verr.Errors, fmt.Sprintf("unknown field %s", key))
+			}
+			return nil
+		}
+
+		if vt == js.Null {
+			if field.Required {
+				verr.Errors = append(verr.Errors, fmt.Sprintf("null required field %s", key))
+			}
+			return nil
+		}
+
+		if !field.Type.matches(value, vt) {
+			verr.Errors = append(verr.Errors, fmt.Sprintf("field %s is not of type %s", key, field.Type))
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, field := range s.Fields {
+		if field.Required && !js.Has(event, field.Name) {
+			verr.Errors = append(verr.Errors, fmt.Sprintf("missing required field %s", field.Name))
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// matches checks the raw value against the field type
+func (t FieldType) matches(value []byte, vt js.ValueType) (ok bool) {
+	switch t {
+	case FieldNumber:
+		return vt == js.Number
+	case FieldString:
+		return vt == js.String
+	case FieldBool:
+		return vt == js.Boolean
+	case FieldTime:
+		if vt != js.String {
+			return false
+		}
+		_, err := time.Parse(time.RFC3339Nano, string(value))
+		return err == nil
+	}
+	return false
+}
+
+// jsonSchemaProperty returns the JSON Schema property for this field
+func (f *Field) jsonSchemaProperty() (prop map[string]interface{}) {
+	prop = map[string]interface{}{}
+
+	var jsType string
+	switch f.Type {
+	case FieldNumber:
+		jsType = "number"
+	case FieldBool:
+		jsType = "boolean"
+	case FieldTime:
+		jsType = "string"
+		prop["format"] = "date-time"
+	case FieldString:
+		jsType = "string"
+	}
+
+	if jsType != "" {
+		if f.Required {
+			prop["type"] = jsType
+		} else {
+			prop["type"] = []string{jsType, "null"}
+		}
+	}
+
+	if f.Description != "" {
+		prop["description"] = f.Description
+	}
+	if f.Kind != "" {
+		prop["x-kind"] = f.Kind
+	}
+	if f.Unit != "" {
+		prop["x-unit"] = f.Unit
+	}
+	return prop
+}
+
+// JSONSchema exports the schema of the events emitted by this collector as a JSON Schema document.
+// Fields included from joined collectors are described with the joined collector schema when available
+func (c *Collector) JSONSchema() (doc []byte, err error) {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for _, field := range baseFields {
+		properties[field.Name] = field.jsonSchemaProperty()
+		required = append(required, field.Name)
+	}
+
+	for _, join := range c.Joins {
+		var joined *Schema
+		if coll, ok := Registry.lookup(join.Name); ok {
+			joined = coll.Schema
+		}
+
+		for _, name := range join.IncludeFields {
+			prop := map[string]interface{}{}
+			if joined != nil {
+				if field, ok := joined.Field(name); ok {
+					// Joined fields are absent when the join does not match
+					optional := *field
+					optional.Required = false
+					prop = optional.jsonSchemaProperty()
+				}
+			}
+			prop["x-join"] = join.Name
+			properties[name] = prop
+		}
+	}
+
+	additional := true
+	if c.Schema != nil {
+		for _, field := range c.Schema.Fields {
+			properties[field.Name] = field.jsonSchemaProperty()
+			if field.Required {
+				required = append(required, field.Name)
+			}
+		}
+		additional = !c.Schema.Strict
+	}
+
+	sort.Strings(required)
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                c.Name,
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": additional,
+	}, "", "  ")
+}
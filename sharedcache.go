@@ -0,0 +1,170 @@
+package tact
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJoinCacheSize is the default size in bytes of the process wide join cache
+	DefaultJoinCacheSize = 64 << 20
+)
+
+// joinCache holds the decoded join data shared by concurrent runs
+var joinCache = newSharedCache(DefaultJoinCacheSize)
+
+// SetJoinCacheSize sets the size bound in bytes of the process wide join cache, evicting entries as needed
+func SetJoinCacheSize(size int) {
+	joinCache.resize(size)
+}
+
+// cacheEntry is the data of a joined collector on a node with its indexes
+type cacheEntry struct {
+	events  [][]byte
+	updated time.Time
+	size    int
+	mtx     sync.Mutex
+	indexes map[string]map[string][]byte // Indexes by key set
+}
+
+func newCacheEntry(events [][]byte, updated time.Time) (entry *cacheEntry) {
+	entry = &cacheEntry{events: events, updated: updated, indexes: map[string]map[string][]byte{}}
+	for _, event := range events {
+		entry.size += len(event)
+	}
+	return entry
+}
+
+// index returns the events indexed by the given keys, building it once per key set.
+// The returned map is shared and must not be modified
+func (e *cacheEntry) index(ctx *Context, keys []*Key) (cache map[string][]byte) {
+	names := make([]string, len(keys))
+	for i := range keys {
+		names[i] = keys[i].String()
+	}
+	id := strings.Join(names, "|")
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if cache, ok := e.indexes[id]; ok {
+		return cache
+	}
+	cache = indexCache(ctx, e.events, keys)
+	e.indexes[id] = cache
+	return cache
+}
+
+// sharedCache is a size bounded LRU of cache entries keyed by collector and node,
+// deduplicating concurrent loads of the same entry
+type sharedCache struct {
+	mtx     sync.Mutex
+	maxSize int
+	size    int
+	lru     *list.List
+	items   map[string]*list.Element
+	loads   map[string]*cacheLoad
+}
+
+// sharedItem is an element of the LRU list
+type sharedItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+// cacheLoad is a running load of an entry
+type cacheLoad struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+func newSharedCache(size int) (c *sharedCache) {
+	return &sharedCache{
+		maxSize: size,
+		lru:     list.New(),
+		items:   map[string]*list.Element{},
+		loads:   map[string]*cacheLoad{},
+	}
+}
+
+// get returns the entry for the key, loading it once for concurrent callers when not present.
+// The load function can return a nil entry when there is no data
+func (c *sharedCache) get(key string, load func() (*cacheEntry, error)) (entry *cacheEntry, err error) {
+	c.mtx.Lock()
+	if el, ok := c.items[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mtx.Unlock()
+		return el.Value.(*sharedItem).entry, nil
+	}
+
+	if l, ok := c.loads[key]; ok {
+		c.mtx.Unlock()
+		<-l.done
+		return l.entry, l.err
+	}
+
+	l := &cacheLoad{done: make(chan struct{})}
+	c.loads[key] = l
+	c.mtx.Unlock()
+
+	l.entry, l.err = load()
+
+	c.mtx.Lock()
+	delete(c.loads, key)
+	if l.err == nil && l.entry != nil {
+		c.setLocked(key, l.entry)
+	}
+	c.mtx.Unlock()
+	close(l.done)
+
+	return l.entry, l.err
+}
+
+// set the entry for the key replacing any existing one
+func (c *sharedCache) set(key string, entry *cacheEntry) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.setLocked(key, entry)
+}
+
+func (c *sharedCache) setLocked(key string, entry *cacheEntry) {
+	if el, ok := c.items[key]; ok {
+		c.size -= el.Value.(*sharedItem).entry.size
+		c.lru.Remove(el)
+		delete(c.items, key)
+	}
+
+	// Entries larger than the cache are not kept
+	if entry.size > c.maxSize {
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&sharedItem{key: key, entry: entry})
+	c.size += entry.size
+	c.evictLocked()
+}
+
+// resize the cache evicting entries as needed
+func (c *sharedCache) resize(size int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.maxSize = size
+	c.evictLocked()
+}
+
+// evictLocked removes the least recently used entries until the cache fits its size
+func (c *sharedCache) evictLocked() {
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		item := el.Value.(*sharedItem)
+		c.lru.Remove(el)
+		delete(c.items, item.key)
+		c.size -= item.entry.size
+	}
+}
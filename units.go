@@ -0,0 +1,97 @@
+package tact
+
+import (
+	"fmt"
+
+	"github.com/brunotm/tact/js"
+)
+
+// Unit of a field value
+type Unit string
+
+// Units for conversion, values are converted to the canonical unit of their dimension:
+// MB for data, ms for time and percent for fractions
+const (
+	Bytes        Unit = "bytes"
+	Kilobytes    Unit = "KB"
+	Megabytes    Unit = "MB"
+	Gigabytes    Unit = "GB"
+	Sectors      Unit = "sectors" // 512 bytes disk sectors
+	Pages        Unit = "pages"   // 4096 bytes memory pages
+	Microseconds Unit = "us"
+	Milliseconds Unit = "ms"
+	Seconds      Unit = "s"
+	Ratio        Unit = "ratio" // Fraction of 1
+	Percent      Unit = "percent"
+)
+
+const (
+	sectorSize = 512
+	pageSize   = 4096
+)
+
+// conversion to a canonical unit
+type conversion struct {
+	canonical Unit
+	factor    float64
+}
+
+var conversions = map[Unit]conversion{
+	Bytes:        {Megabytes, 1.0 / 1000 / 1000},
+	Kilobytes:    {Megabytes, 1.0 / 1000},
+	Megabytes:    {Megabytes, 1},
+	Gigabytes:    {Megabytes, 1000},
+	Sectors:      {Megabytes, sectorSize / 1000.0 / 1000},
+	Pages:        {Megabytes, pageSize / 1000.0 / 1000},
+	Microseconds: {Milliseconds, 1.0 / 1000},
+	Milliseconds: {Milliseconds, 1},
+	Seconds:      {Milliseconds, 1000},
+	Ratio:        {Percent, 100},
+	Percent:      {Percent, 1},
+}
+
+// Canonical returns the canonical unit values in this unit are converted to
+func (u Unit) Canonical() (canonical Unit, err error) {
+	conv, ok := conversions[u]
+	if !ok {
+		return "", fmt.Errorf("unknown unit: %s", u)
+	}
+	return conv.canonical, nil
+}
+
+// convertUnits converts the specified fields to their canonical units
+func (eo *EventOps) convertUnits(ctx *Context, event []byte) (out []byte) {
+	for field, unit := range eo.Units {
+		if !js.Has(event, field) {
+			continue
+		}
+
+		value, err := js.GetFloat(event, field)
+		if err != nil {
+			ctx.LogError("unit conversion error fetching field", "field", field, "error", err)
+			continue
+		}
+
+		if event, err = js.Set(event, value*conversions[unit].factor, field); err != nil {
+			ctx.LogError("unit conversion error setting field", "field", field, "error", err)
+			continue
+		}
+	}
+	return event
+}
+
+// fieldUnit returns the unit of the given field after all event ops are applied
+func (eo *EventOps) fieldUnit(field string) (unit Unit) {
+	unit, ok := eo.Units[field]
+	if !ok {
+		return ""
+	}
+	unit = conversions[unit].canonical
+
+	if eo.Delta != nil {
+		if mode, _ := eo.Delta.mode(field); mode == DeltaRate {
+			return unit + "/s"
+		}
+	}
+	return unit
+}
@@ -3,7 +3,10 @@ package tact
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 
+	"github.com/brunotm/tact/collector/keys"
+	"github.com/brunotm/tact/js"
 	blake2b "github.com/minio/blake2b-simd"
 )
 
@@ -33,3 +36,23 @@ func Hash(v []byte) (h string) {
 	b2b.Write(v)
 	return hex.EncodeToString(b2b.Sum(nil))
 }
+
+// annotateError appends the given error to the event errors field
+func annotateError(event []byte, err error) (out []byte) {
+	return appendString(event, keys.Errors, err.Error())
+}
+
+// appendString appends the value to the string array in the given event field
+func appendString(event []byte, field, value string) (out []byte) {
+	var values []string
+	if raw, err := js.Get(event, field); err == nil {
+		json.Unmarshal(raw, &values)
+	}
+	values = append(values, value)
+
+	out, err := js.Set(event, values, field)
+	if err != nil {
+		return event
+	}
+	return out
+}